@@ -3,6 +3,10 @@ module github.com/diamondoughnut/gator
 go 1.25.0
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/andybalholm/brotli v1.2.0
+	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.10.9
+	golang.org/x/net v0.57.0
 )
+
+require golang.org/x/text v0.40.0 // indirect
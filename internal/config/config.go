@@ -8,6 +8,11 @@ import (
 type Config struct{
 	DbUrl string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+	// FetchAllowlist lists hostnames, IPs or CIDR ranges that feeds may be
+	// fetched from even though they are private or reserved addresses.
+	FetchAllowlist []string `json:"fetch_allowlist,omitempty"`
+	// MaxFeedBytes caps the decoded size of a fetched feed; 0 uses the default.
+	MaxFeedBytes int64 `json:"max_feed_bytes,omitempty"`
 }
 
 func ConfigPath() (string, error){
@@ -14,16 +14,16 @@ import (
 
 const createFeedFollow = `-- name: CreateFeedFollow :one
 WITH inserted_feed_follow AS (
-    INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_url)
+    INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
     VALUES ($1, $2, $3, $4, $5)
-    RETURNING id, created_at, updated_at, user_id, feed_url
+    RETURNING id, created_at, updated_at, user_id, feed_id
 )
 SELECT
-    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_url,
+    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id,
     feeds.name AS feed_name,
     users.name AS user_name
 FROM inserted_feed_follow
-INNER JOIN feeds ON inserted_feed_follow.feed_url = feeds.url
+INNER JOIN feeds ON inserted_feed_follow.feed_id = feeds.id
 INNER JOIN users ON inserted_feed_follow.user_id = users.id
 `
 
@@ -32,7 +32,7 @@ type CreateFeedFollowParams struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
-	FeedUrl   string
+	FeedID    uuid.UUID
 }
 
 type CreateFeedFollowRow struct {
@@ -40,7 +40,7 @@ type CreateFeedFollowRow struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
-	FeedUrl   string
+	FeedID    uuid.UUID
 	FeedName  string
 	UserName  string
 }
@@ -51,7 +51,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.UserID,
-		arg.FeedUrl,
+		arg.FeedID,
 	)
 	var i CreateFeedFollowRow
 	err := row.Scan(
@@ -59,35 +59,39 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
-		&i.FeedUrl,
+		&i.FeedID,
 		&i.FeedName,
 		&i.UserName,
 	)
 	return i, err
 }
 
-const deleteFeedFollowByUserAndFeedUrl = `-- name: DeleteFeedFollowByUserAndFeedUrl :exec
+const deleteFeedFollowByUserAndFeed = `-- name: DeleteFeedFollowByUserAndFeed :execrows
 DELETE FROM feed_follows
-WHERE user_id = $1 AND feed_url = $2
+WHERE user_id = $1 AND feed_id = $2
 `
 
-type DeleteFeedFollowByUserAndFeedUrlParams struct {
-	UserID  uuid.UUID
-	FeedUrl string
+type DeleteFeedFollowByUserAndFeedParams struct {
+	UserID uuid.UUID
+	FeedID uuid.UUID
 }
 
-func (q *Queries) DeleteFeedFollowByUserAndFeedUrl(ctx context.Context, arg DeleteFeedFollowByUserAndFeedUrlParams) error {
-	_, err := q.db.ExecContext(ctx, deleteFeedFollowByUserAndFeedUrl, arg.UserID, arg.FeedUrl)
-	return err
+func (q *Queries) DeleteFeedFollowByUserAndFeed(ctx context.Context, arg DeleteFeedFollowByUserAndFeedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFeedFollowByUserAndFeed, arg.UserID, arg.FeedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 SELECT
-    feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_url,
+    feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id,
     feeds.name AS feed_name,
+    feeds.url AS feed_url,
     users.name AS user_name
 FROM feed_follows
-INNER JOIN feeds ON feed_follows.feed_url = feeds.url
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
 INNER JOIN users ON feed_follows.user_id = users.id
 WHERE users.id = $1
 `
@@ -97,8 +101,9 @@ type GetFeedFollowsForUserRow struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
-	FeedUrl   string
+	FeedID    uuid.UUID
 	FeedName  string
+	FeedUrl   string
 	UserName  string
 }
 
@@ -116,8 +121,9 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, id uuid.UUID) ([]Ge
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
-			&i.FeedUrl,
+			&i.FeedID,
 			&i.FeedName,
+			&i.FeedUrl,
 			&i.UserName,
 		); err != nil {
 			return nil, err
@@ -132,3 +138,24 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, id uuid.UUID) ([]Ge
 	}
 	return items, nil
 }
+
+const moveFeedFollows = `-- name: MoveFeedFollows :exec
+UPDATE feed_follows
+SET feed_id = $1, updated_at = NOW()
+WHERE feed_follows.feed_id = $2
+AND feed_follows.user_id NOT IN (
+    SELECT user_id FROM feed_follows AS existing WHERE existing.feed_id = $1
+)
+`
+
+type MoveFeedFollowsParams struct {
+	NewFeedID uuid.UUID
+	OldFeedID uuid.UUID
+}
+
+// Follows that would duplicate an existing follow of the target feed are
+// left behind and removed when the old feed is deleted.
+func (q *Queries) MoveFeedFollows(ctx context.Context, arg MoveFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedFollows, arg.NewFeedID, arg.OldFeedID)
+	return err
+}
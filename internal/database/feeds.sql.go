@@ -11,10 +11,71 @@ import (
 	"github.com/google/uuid"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET claimed_until = NOW() + ($1::int * INTERVAL '1 second')
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (claimed_until IS NULL OR claimed_until < NOW())
+    AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+    AND dead_at IS NULL
+    AND (last_fetched_at IS NULL OR last_fetched_at < NOW() - ($2::int * INTERVAL '1 second'))
+    ORDER BY last_fetched_at NULLS FIRST
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING name, url, user_id, last_fetched_at, updated_at, created_at, etag, last_modified, claimed_until, consecutive_failures, last_error, last_error_at, next_fetch_at, dead_at, id
+`
+
+type ClaimFeedsToFetchParams struct {
+	LeaseSeconds  int32
+	MinAgeSeconds int32
+	BatchSize     int32
+}
+
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.LeaseSeconds, arg.MinAgeSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.UpdatedAt,
+			&i.CreatedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.NextFetchAt,
+			&i.DeadAt,
+			&i.ID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (name, url, user_id)
 VALUES ($1, $2, $3)
-RETURNING name, url, user_id, last_fetched_at, updated_at, created_at
+RETURNING name, url, user_id, last_fetched_at, updated_at, created_at, etag, last_modified, claimed_until, consecutive_failures, last_error, last_error_at, next_fetch_at, dead_at, id
 `
 
 type CreateFeedParams struct {
@@ -33,12 +94,57 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.LastFetchedAt,
 		&i.UpdatedAt,
 		&i.CreatedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.NextFetchAt,
+		&i.DeadAt,
+		&i.ID,
+	)
+	return i, err
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const getFeedByID = `-- name: GetFeedByID :one
+SELECT name, url, user_id, last_fetched_at, updated_at, created_at, etag, last_modified, claimed_until, consecutive_failures, last_error, last_error_at, next_fetch_at, dead_at, id FROM feeds WHERE id = $1
+`
+
+func (q *Queries) GetFeedByID(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByID, id)
+	var i Feed
+	err := row.Scan(
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.UpdatedAt,
+		&i.CreatedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.NextFetchAt,
+		&i.DeadAt,
+		&i.ID,
 	)
 	return i, err
 }
 
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT name, url, user_id, last_fetched_at, updated_at, created_at FROM feeds WHERE url = $1
+SELECT name, url, user_id, last_fetched_at, updated_at, created_at, etag, last_modified, claimed_until, consecutive_failures, last_error, last_error_at, next_fetch_at, dead_at, id FROM feeds WHERE url = $1
 `
 
 func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
@@ -51,12 +157,21 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.LastFetchedAt,
 		&i.UpdatedAt,
 		&i.CreatedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.NextFetchAt,
+		&i.DeadAt,
+		&i.ID,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT name, url, user_id, last_fetched_at, updated_at, created_at FROM feeds
+SELECT name, url, user_id, last_fetched_at, updated_at, created_at, etag, last_modified, claimed_until, consecutive_failures, last_error, last_error_at, next_fetch_at, dead_at, id FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -75,6 +190,15 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.LastFetchedAt,
 			&i.UpdatedAt,
 			&i.CreatedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.NextFetchAt,
+			&i.DeadAt,
+			&i.ID,
 		); err != nil {
 			return nil, err
 		}
@@ -89,33 +213,153 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT name, url, user_id, last_fetched_at, updated_at, created_at FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
-LIMIT 1
+const getFeedsByName = `-- name: GetFeedsByName :many
+SELECT name, url, user_id, last_fetched_at, updated_at, created_at, etag, last_modified, claimed_until, consecutive_failures, last_error, last_error_at, next_fetch_at, dead_at, id FROM feeds WHERE name = $1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i Feed
-	err := row.Scan(
-		&i.Name,
-		&i.Url,
-		&i.UserID,
-		&i.LastFetchedAt,
-		&i.UpdatedAt,
-		&i.CreatedAt,
-	)
-	return i, err
+func (q *Queries) GetFeedsByName(ctx context.Context, name string) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsByName, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.UpdatedAt,
+			&i.CreatedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.NextFetchAt,
+			&i.DeadAt,
+			&i.ID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedDead = `-- name: MarkFeedDead :exec
+UPDATE feeds
+SET dead_at = NOW(), updated_at = NOW(), last_fetched_at = NOW(), claimed_until = NULL,
+    last_error = $2, last_error_at = NOW()
+WHERE id = $1
+`
+
+type MarkFeedDeadParams struct {
+	ID        uuid.UUID
+	LastError string
+}
+
+func (q *Queries) MarkFeedDead(ctx context.Context, arg MarkFeedDeadParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedDead, arg.ID, arg.LastError)
+	return err
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :exec
 UPDATE feeds
-SET last_fetched_at = NOW(), updated_at = NOW()
-WHERE url = $1
+SET last_fetched_at = NOW(), updated_at = NOW(),
+    claimed_until = CASE WHEN $1::boolean THEN NULL ELSE claimed_until END,
+    consecutive_failures = 0, next_fetch_at = NULL
+WHERE id = $2
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, url string) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, url)
+type MarkFeedFetchedParams struct {
+	ReleaseClaim bool
+	ID           uuid.UUID
+}
+
+// release_claim is false when the feed was merged into during the fetch of
+// another one: its claim, if any, belongs to whoever holds it.
+func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.ReleaseClaim, arg.ID)
+	return err
+}
+
+const recordFeedFailure = `-- name: RecordFeedFailure :exec
+UPDATE feeds
+SET last_fetched_at = NOW(), updated_at = NOW(),
+    claimed_until = CASE WHEN $1::boolean THEN NULL ELSE claimed_until END,
+    consecutive_failures = consecutive_failures + 1,
+    last_error = $2,
+    last_error_at = NOW(),
+    next_fetch_at = NOW() + LEAST(
+        INTERVAL '2 minutes' * POWER(2, LEAST(consecutive_failures, 10)),
+        INTERVAL '1 day'
+    )
+WHERE id = $3
+`
+
+type RecordFeedFailureParams struct {
+	ReleaseClaim bool
+	LastError    string
+	ID           uuid.UUID
+}
+
+// Backoff doubles from 2 minutes with each consecutive failure, capped at a day.
+// release_claim works as in MarkFeedFetched.
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedFailure, arg.ReleaseClaim, arg.LastError, arg.ID)
+	return err
+}
+
+const releaseFeedClaim = `-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_until = NULL
+WHERE id = $1
+`
+
+func (q *Queries) ReleaseFeedClaim(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedClaim, id)
+	return err
+}
+
+const updateFeedCacheHeaders = `-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedCacheHeadersParams struct {
+	ID           uuid.UUID
+	Etag         string
+	LastModified string
+}
+
+func (q *Queries) UpdateFeedCacheHeaders(ctx context.Context, arg UpdateFeedCacheHeadersParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedCacheHeaders, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
+
+const updateFeedUrl = `-- name: UpdateFeedUrl :exec
+UPDATE feeds
+SET url = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedUrlParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) UpdateFeedUrl(ctx context.Context, arg UpdateFeedUrlParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedUrl, arg.ID, arg.Url)
 	return err
 }
@@ -12,12 +12,21 @@ import (
 )
 
 type Feed struct {
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
-	UpdatedAt     time.Time
-	CreatedAt     time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	UpdatedAt           time.Time
+	CreatedAt           time.Time
+	Etag                string
+	LastModified        string
+	ClaimedUntil        sql.NullTime
+	ConsecutiveFailures int32
+	LastError           string
+	LastErrorAt         sql.NullTime
+	NextFetchAt         sql.NullTime
+	DeadAt              sql.NullTime
+	ID                  uuid.UUID
 }
 
 type FeedFollow struct {
@@ -25,18 +34,69 @@ type FeedFollow struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
-	FeedUrl   string
+	FeedID    uuid.UUID
 }
 
 type Post struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Title           string
+	Url             string
+	Description     string
+	PublishedAt     sql.NullTime
+	FeedID          uuid.UUID
+	Guid            string
+	LegacyGuid      bool
+	ContentHash     sql.NullString
+	Author          string
+	Content         string
+	CommentsUrl     string
+	SourceTitle     string
+	SourceUrl       string
+	AttachmentsHash sql.NullString
+	SearchVector    interface{}
+}
+
+type PostCategory struct {
+	PostID uuid.UUID
+	Name   string
+}
+
+type PostEnclosure struct {
+	ID              uuid.UUID
+	PostID          uuid.UUID
+	Url             string
+	MimeType        string
+	Medium          string
+	Length          int64
+	DurationSeconds int32
+	Position        int32
+}
+
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+type PostRevision struct {
 	ID          uuid.UUID
+	PostID      uuid.UUID
 	CreatedAt   time.Time
-	UpdatedAt   time.Time
 	Title       string
-	Url         string
 	Description string
 	PublishedAt sql.NullTime
-	FeedUrl     string
+	ContentHash string
+}
+
+type PostStar struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Note      string
+	Tags      []string
 }
 
 type User struct {
@@ -0,0 +1,34 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: post_categories.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const setPostCategories = `-- name: SetPostCategories :exec
+WITH removed AS (
+    DELETE FROM post_categories
+    WHERE post_categories.post_id = $1 AND post_categories.name <> ALL($2::text[])
+)
+INSERT INTO post_categories (post_id, name)
+SELECT DISTINCT $1::uuid, unnest($2::text[])
+ON CONFLICT DO NOTHING
+`
+
+type SetPostCategoriesParams struct {
+	PostID uuid.UUID
+	Names  []string
+}
+
+// Replaces a post's categories with names.
+func (q *Queries) SetPostCategories(ctx context.Context, arg SetPostCategoriesParams) error {
+	_, err := q.db.ExecContext(ctx, setPostCategories, arg.PostID, pq.Array(arg.Names))
+	return err
+}
@@ -0,0 +1,95 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: post_enclosures.sql
+
+package sqlc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const getEnclosuresForPosts = `-- name: GetEnclosuresForPosts :many
+SELECT id, post_id, url, mime_type, medium, length, duration_seconds, position FROM post_enclosures
+WHERE post_id = ANY($1::uuid[])
+ORDER BY post_id, position
+`
+
+func (q *Queries) GetEnclosuresForPosts(ctx context.Context, postIds []uuid.UUID) ([]PostEnclosure, error) {
+	rows, err := q.db.QueryContext(ctx, getEnclosuresForPosts, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostEnclosure
+	for rows.Next() {
+		var i PostEnclosure
+		if err := rows.Scan(
+			&i.ID,
+			&i.PostID,
+			&i.Url,
+			&i.MimeType,
+			&i.Medium,
+			&i.Length,
+			&i.DurationSeconds,
+			&i.Position,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setPostEnclosures = `-- name: SetPostEnclosures :exec
+WITH removed AS (
+    DELETE FROM post_enclosures
+    WHERE post_enclosures.post_id = $1 AND post_enclosures.url <> ALL($6::text[])
+)
+INSERT INTO post_enclosures (post_id, url, mime_type, medium, length, duration_seconds, position)
+SELECT $1::uuid, e.url,
+    ($2::text[])[e.position],
+    ($3::text[])[e.position],
+    ($4::bigint[])[e.position],
+    ($5::integer[])[e.position],
+    e.position
+FROM unnest($6::text[]) WITH ORDINALITY AS e(url, position)
+ON CONFLICT (post_id, md5(url)) DO UPDATE
+SET mime_type = EXCLUDED.mime_type,
+    medium = EXCLUDED.medium,
+    length = EXCLUDED.length,
+    duration_seconds = EXCLUDED.duration_seconds,
+    position = EXCLUDED.position
+`
+
+type SetPostEnclosuresParams struct {
+	PostID    uuid.UUID
+	MimeTypes []string
+	Media     []string
+	Lengths   []int64
+	Durations []int32
+	Urls      []string
+}
+
+// Replaces a post's enclosures. The arrays are parallel, one entry per
+// enclosure, and must not repeat a url.
+func (q *Queries) SetPostEnclosures(ctx context.Context, arg SetPostEnclosuresParams) error {
+	_, err := q.db.ExecContext(ctx, setPostEnclosures,
+		arg.PostID,
+		pq.Array(arg.MimeTypes),
+		pq.Array(arg.Media),
+		pq.Array(arg.Lengths),
+		pq.Array(arg.Durations),
+		pq.Array(arg.Urls),
+	)
+	return err
+}
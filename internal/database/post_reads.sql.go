@@ -0,0 +1,111 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: post_reads.sql
+
+package sqlc
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const markPostsRead = `-- name: MarkPostsRead :execrows
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, $1::timestamp
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = $2
+AND ($3::uuid IS NULL OR posts.id = $3::uuid)
+AND ($4::text IS NULL OR posts.url = $4::text)
+AND ($5::uuid IS NULL OR posts.feed_id = $5::uuid)
+AND ($6::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < $6::timestamp)
+ON CONFLICT (user_id, post_id) DO NOTHING
+`
+
+type MarkPostsReadParams struct {
+	ReadAt    time.Time
+	UserID    uuid.UUID
+	PostID    uuid.NullUUID
+	Url       sql.NullString
+	FeedID    uuid.NullUUID
+	OlderThan sql.NullTime
+}
+
+// Marks the user's posts matching every non-NULL filter as read. Only posts
+// in feeds the user follows are affected; older_than compares against the
+// publish date, or the fetch time for posts without one.
+func (q *Queries) MarkPostsRead(ctx context.Context, arg MarkPostsReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPostsRead,
+		arg.ReadAt,
+		arg.UserID,
+		arg.PostID,
+		arg.Url,
+		arg.FeedID,
+		arg.OlderThan,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markPostsUnread = `-- name: MarkPostsUnread :execrows
+DELETE FROM post_reads
+USING posts
+WHERE post_reads.post_id = posts.id
+AND post_reads.user_id = $1
+AND ($2::uuid IS NULL OR posts.id = $2::uuid)
+AND ($3::text IS NULL OR posts.url = $3::text)
+AND ($4::uuid IS NULL OR posts.feed_id = $4::uuid)
+AND ($5::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < $5::timestamp)
+`
+
+type MarkPostsUnreadParams struct {
+	UserID    uuid.UUID
+	PostID    uuid.NullUUID
+	Url       sql.NullString
+	FeedID    uuid.NullUUID
+	OlderThan sql.NullTime
+}
+
+// The inverse of MarkPostsRead, taking the same filters.
+func (q *Queries) MarkPostsUnread(ctx context.Context, arg MarkPostsUnreadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markPostsUnread,
+		arg.UserID,
+		arg.PostID,
+		arg.Url,
+		arg.FeedID,
+		arg.OlderThan,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const movePostReads = `-- name: MovePostReads :exec
+UPDATE post_reads
+SET post_id = existing.id
+FROM posts AS old, posts AS existing
+WHERE post_reads.post_id = old.id
+AND old.feed_id = $1
+AND existing.feed_id = $2
+AND existing.guid = old.guid
+AND NOT EXISTS (SELECT 1 FROM post_reads AS kept WHERE kept.user_id = post_reads.user_id AND kept.post_id = existing.id)
+`
+
+type MovePostReadsParams struct {
+	OldFeedID uuid.UUID
+	NewFeedID uuid.UUID
+}
+
+// Before a feed is merged into another, read marks on posts the other feed
+// already has are moved to its copy so they survive the old feed's deletion.
+func (q *Queries) MovePostReads(ctx context.Context, arg MovePostReadsParams) error {
+	_, err := q.db.ExecContext(ctx, movePostReads, arg.OldFeedID, arg.NewFeedID)
+	return err
+}
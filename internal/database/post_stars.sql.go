@@ -0,0 +1,165 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: post_stars.sql
+
+package sqlc
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const getStarredPostsForUser = `-- name: GetStarredPostsForUser :many
+SELECT posts.id, posts.title, posts.url, feeds.name AS feed_name,
+    post_stars.note, post_stars.tags, post_stars.created_at AS starred_at
+FROM post_stars
+INNER JOIN posts ON post_stars.post_id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE post_stars.user_id = $1
+AND ($2::text IS NULL OR post_stars.tags @> ARRAY[$2::text])
+ORDER BY post_stars.created_at DESC
+LIMIT $3
+`
+
+type GetStarredPostsForUserParams struct {
+	UserID uuid.UUID
+	Tag    sql.NullString
+	Limit  int32
+}
+
+type GetStarredPostsForUserRow struct {
+	ID        uuid.UUID
+	Title     string
+	Url       string
+	FeedName  string
+	Note      string
+	Tags      []string
+	StarredAt time.Time
+}
+
+// Starred posts stay listed even after the user unfollows their feed.
+func (q *Queries) GetStarredPostsForUser(ctx context.Context, arg GetStarredPostsForUserParams) ([]GetStarredPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStarredPostsForUser, arg.UserID, arg.Tag, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStarredPostsForUserRow
+	for rows.Next() {
+		var i GetStarredPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.FeedName,
+			&i.Note,
+			pq.Array(&i.Tags),
+			&i.StarredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const movePostStars = `-- name: MovePostStars :exec
+UPDATE post_stars
+SET post_id = existing.id, updated_at = NOW()
+FROM posts AS old, posts AS existing
+WHERE post_stars.post_id = old.id
+AND old.feed_id = $1
+AND existing.feed_id = $2
+AND existing.guid = old.guid
+AND NOT EXISTS (
+    SELECT 1 FROM post_stars AS kept
+    WHERE kept.user_id = post_stars.user_id AND kept.post_id = existing.id
+)
+`
+
+type MovePostStarsParams struct {
+	OldFeedID uuid.UUID
+	NewFeedID uuid.UUID
+}
+
+// Before a feed is merged into another, stars on posts the other feed
+// already has are moved to its copy so they survive the old feed's deletion.
+func (q *Queries) MovePostStars(ctx context.Context, arg MovePostStarsParams) error {
+	_, err := q.db.ExecContext(ctx, movePostStars, arg.OldFeedID, arg.NewFeedID)
+	return err
+}
+
+const starPosts = `-- name: StarPosts :execrows
+INSERT INTO post_stars (user_id, post_id, created_at, updated_at, note, tags)
+SELECT feed_follows.user_id, posts.id, $1::timestamp, $1::timestamp,
+    COALESCE($2::text, ''), COALESCE($3::text[], '{}')
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = $4
+AND ($5::uuid IS NULL OR posts.id = $5::uuid)
+AND ($6::text IS NULL OR posts.url = $6::text)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET note = COALESCE($2::text, post_stars.note),
+    tags = COALESCE($3::text[], post_stars.tags),
+    updated_at = EXCLUDED.updated_at
+`
+
+type StarPostsParams struct {
+	StarredAt time.Time
+	Note      sql.NullString
+	Tags      []string
+	UserID    uuid.UUID
+	PostID    uuid.NullUUID
+	Url       sql.NullString
+}
+
+// Stars the posts in the user's followed feeds matching post_id or url.
+// Starring a post again replaces its note and tags when they are given.
+func (q *Queries) StarPosts(ctx context.Context, arg StarPostsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, starPosts,
+		arg.StarredAt,
+		arg.Note,
+		pq.Array(arg.Tags),
+		arg.UserID,
+		arg.PostID,
+		arg.Url,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unstarPosts = `-- name: UnstarPosts :execrows
+DELETE FROM post_stars
+USING posts
+WHERE post_stars.post_id = posts.id
+AND post_stars.user_id = $1
+AND ($2::uuid IS NULL OR posts.id = $2::uuid)
+AND ($3::text IS NULL OR posts.url = $3::text)
+`
+
+type UnstarPostsParams struct {
+	UserID uuid.UUID
+	PostID uuid.NullUUID
+	Url    sql.NullString
+}
+
+func (q *Queries) UnstarPosts(ctx context.Context, arg UnstarPostsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unstarPosts, arg.UserID, arg.PostID, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -11,79 +11,303 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, description, published_at, url, feed_url)
-VALUES (DEFAULT, $1, $2, $3, $4, $5, $6, $7)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_url
+const getPostRevisionsForUser = `-- name: GetPostRevisionsForUser :many
+SELECT post_revisions.id, post_revisions.post_id, post_revisions.created_at, post_revisions.title, post_revisions.description, post_revisions.published_at, post_revisions.content_hash, posts.title AS current_title, feeds.name AS feed_name
+FROM post_revisions
+INNER JOIN posts ON post_revisions.post_id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = $1
+AND ($2::uuid IS NULL OR posts.id = $2::uuid)
+AND ($3::text IS NULL OR posts.url = $3::text)
+ORDER BY feeds.name, posts.id, post_revisions.created_at DESC
 `
 
-type CreatePostParams struct {
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+type GetPostRevisionsForUserParams struct {
+	UserID uuid.UUID
+	PostID uuid.NullUUID
+	Url    sql.NullString
+}
+
+type GetPostRevisionsForUserRow struct {
+	ID           uuid.UUID
+	PostID       uuid.UUID
+	CreatedAt    time.Time
+	Title        string
+	Description  string
+	PublishedAt  sql.NullTime
+	ContentHash  string
+	CurrentTitle string
+	FeedName     string
+}
+
+// Earlier versions of the post with post_id, or of every post at url, in
+// feeds the user follows. Revisions of one post are adjacent, newest first.
+func (q *Queries) GetPostRevisionsForUser(ctx context.Context, arg GetPostRevisionsForUserParams) ([]GetPostRevisionsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostRevisionsForUser, arg.UserID, arg.PostID, arg.Url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostRevisionsForUserRow
+	for rows.Next() {
+		var i GetPostRevisionsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PostID,
+			&i.CreatedAt,
+			&i.Title,
+			&i.Description,
+			&i.PublishedAt,
+			&i.ContentHash,
+			&i.CurrentTitle,
+			&i.FeedName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForUser = `-- name: GetPostsForUser :many
+SELECT posts.id, posts.title, posts.url, posts.description, posts.content,
+    posts.published_at, posts.feed_id, posts.author, posts.comments_url,
+    posts.source_title, posts.source_url,
+    feeds.name AS feed_name, feeds.url AS feed_url,
+    COALESCE((
+        SELECT array_agg(post_categories.name ORDER BY post_categories.name)
+        FROM post_categories WHERE post_categories.post_id = posts.id
+    ), '{}')::text[] AS categories,
+    (post_reads.post_id IS NOT NULL)::boolean AS read,
+    (CASE WHEN $1::text = 'fetched' THEN posts.created_at
+          ELSE COALESCE(posts.published_at, posts.created_at) END)::timestamp AS sort_time
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_reads ON post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $2
+AND ($3::boolean OR post_reads.post_id IS NULL)
+AND ($4::uuid IS NULL OR posts.feed_id = $4::uuid)
+AND ($5::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= $5::timestamp)
+AND ($6::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < $6::timestamp)
+AND ($7::text IS NULL OR strpos(lower(posts.author), lower($7::text)) > 0)
+AND ($8::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_categories
+    WHERE post_categories.post_id = posts.id AND lower(post_categories.name) = lower($8::text)
+))
+AND ($9::text[] IS NULL OR EXISTS (
+    SELECT 1 FROM post_enclosures
+    WHERE post_enclosures.post_id = posts.id AND post_enclosures.medium = ANY($9::text[])
+))
+AND ($10::uuid IS NULL OR (
+    CASE WHEN $1::text = 'feed' THEN
+        (feeds.name, feeds.id) > ($11::text, $12::uuid)
+        OR ((feeds.name, feeds.id) = ($11::text, $12::uuid)
+            AND (COALESCE(posts.published_at, posts.created_at), posts.id) < ($13::timestamp, $10::uuid))
+    WHEN $1::text = 'fetched' THEN
+        (posts.created_at, posts.id) < ($13::timestamp, $10::uuid)
+    ELSE
+        (COALESCE(posts.published_at, posts.created_at), posts.id) < ($13::timestamp, $10::uuid)
+    END
+))
+ORDER BY
+    CASE WHEN $1::text = 'feed' THEN feeds.name END,
+    CASE WHEN $1::text = 'feed' THEN feeds.id END,
+    sort_time DESC,
+    posts.id DESC
+LIMIT $15
+OFFSET $14
+`
+
+type GetPostsForUserParams struct {
+	SortBy        string
+	UserID        uuid.UUID
+	IncludeRead   bool
+	FeedID        uuid.NullUUID
+	Since         sql.NullTime
+	Until         sql.NullTime
+	Author        sql.NullString
+	Category      sql.NullString
+	Media         []string
+	AfterID       uuid.NullUUID
+	AfterFeedName sql.NullString
+	AfterFeedID   uuid.NullUUID
+	AfterTime     sql.NullTime
+	Offset        int32
+	Limit         int32
+}
+
+type GetPostsForUserRow struct {
+	ID          uuid.UUID
 	Title       string
+	Url         string
 	Description string
+	Content     string
 	PublishedAt sql.NullTime
-	Url         string
+	FeedID      uuid.UUID
+	Author      string
+	CommentsUrl string
+	SourceTitle string
+	SourceUrl   string
+	FeedName    string
 	FeedUrl     string
+	Categories  []string
+	Read        bool
+	SortTime    time.Time
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Description,
-		arg.PublishedAt,
-		arg.Url,
-		arg.FeedUrl,
+// author matches any part of the author, category a whole category name;
+// both ignore case. media keeps posts with an enclosure of one of the given
+// media, feed_id posts from one feed, and since/until bound the publish
+// date (the fetch time for posts without one). Each filter is skipped when
+// NULL. Read posts are left out unless include_read is set.
+//
+// sort_by is published (newest first), fetched (most recently stored
+// first) or feed (by feed name, then newest first). Pages are fetched
+// either by offset or by passing the sort position of the last row seen
+// (after_*), which stays stable while new posts arrive.
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser,
+		arg.SortBy,
+		arg.UserID,
+		arg.IncludeRead,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.Author,
+		arg.Category,
+		pq.Array(arg.Media),
+		arg.AfterID,
+		arg.AfterFeedName,
+		arg.AfterFeedID,
+		arg.AfterTime,
+		arg.Offset,
+		arg.Limit,
 	)
-	var i Post
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Url,
-		&i.Description,
-		&i.PublishedAt,
-		&i.FeedUrl,
-	)
-	return i, err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsForUserRow
+	for rows.Next() {
+		var i GetPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.Content,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Author,
+			&i.CommentsUrl,
+			&i.SourceTitle,
+			&i.SourceUrl,
+			&i.FeedName,
+			&i.FeedUrl,
+			pq.Array(&i.Categories),
+			&i.Read,
+			&i.SortTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_url FROM posts
-INNER JOIN feed_follows ON posts.feed_url = feed_follows.feed_url
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC NULLS LAST
-LIMIT $2
+const movePosts = `-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = $1, updated_at = NOW()
+WHERE posts.feed_id = $2
+AND NOT EXISTS (
+    SELECT 1 FROM posts AS existing
+    WHERE existing.feed_id = $1 AND existing.guid = posts.guid
+)
 `
 
-type GetPostsForUserParams struct {
+type MovePostsParams struct {
+	NewFeedID uuid.UUID
+	OldFeedID uuid.UUID
+}
+
+func (q *Queries) MovePosts(ctx context.Context, arg MovePostsParams) error {
+	_, err := q.db.ExecContext(ctx, movePosts, arg.NewFeedID, arg.OldFeedID)
+	return err
+}
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT posts.id, posts.title, posts.url, posts.published_at,
+    feeds.name AS feed_name,
+    ts_rank(posts.search_vector, query)::real AS rank,
+    ts_headline('english',
+        regexp_replace(CASE WHEN posts.content <> '' THEN posts.content ELSE posts.description END, '<[^>]*>', ' ', 'g'),
+        query,
+        'StartSel="**", StopSel="**", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" ... "'
+    )::text AS snippet
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+CROSS JOIN websearch_to_tsquery('english', $1::text) AS query
+WHERE feed_follows.user_id = $2
+AND posts.search_vector @@ query
+ORDER BY rank DESC, posts.published_at DESC NULLS LAST, posts.id
+LIMIT $3
+`
+
+type SearchPostsForUserParams struct {
+	Query  string
 	UserID uuid.UUID
 	Limit  int32
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+type SearchPostsForUserRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	PublishedAt sql.NullTime
+	FeedName    string
+	Rank        float32
+	Snippet     string
+}
+
+// query uses web search syntax: "quoted phrases", -excluded words and OR.
+// Only posts in feeds the user follows are searched, best matches first.
+// The snippet is taken from the content, or the description when there is
+// none, with HTML tags removed and matches wrapped in ** **.
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser, arg.Query, arg.UserID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []SearchPostsForUserRow
 	for rows.Next() {
-		var i Post
+		var i SearchPostsForUserRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
 			&i.Title,
 			&i.Url,
-			&i.Description,
 			&i.PublishedAt,
-			&i.FeedUrl,
+			&i.FeedName,
+			&i.Rank,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -97,3 +321,125 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const upsertPost = `-- name: UpsertPost :one
+WITH previous AS (
+    SELECT posts.id, posts.title, posts.description, posts.published_at, posts.content_hash
+    FROM posts
+    WHERE posts.feed_id = $1 AND md5(posts.guid) = md5($2::text)
+), legacy AS (
+    SELECT posts.id
+    FROM posts
+    WHERE posts.feed_id = $1 AND posts.legacy_guid
+    AND md5(posts.url) = md5($3::text)
+    AND NOT EXISTS (SELECT 1 FROM previous)
+    LIMIT 1
+), adopted AS (
+    UPDATE posts
+    SET guid = $2::text,
+        legacy_guid = FALSE,
+        title = $4::text,
+        description = $5::text,
+        published_at = COALESCE($6::timestamp, posts.published_at),
+        url = $3::text,
+        content_hash = $7::text,
+        author = $8::text,
+        content = $9::text,
+        comments_url = $10::text,
+        source_title = $11::text,
+        source_url = $12::text,
+        attachments_hash = $13::text,
+        updated_at = $14::timestamp
+    FROM legacy
+    WHERE posts.id = legacy.id
+    RETURNING posts.id
+), upserted AS (
+    INSERT INTO posts (id, created_at, updated_at, title, description, published_at, url, feed_id, guid, content_hash, author, content, comments_url, source_title, source_url, attachments_hash)
+    SELECT $15::uuid, $16::timestamp, $14::timestamp, $4::text, $5::text, COALESCE($6::timestamp, $17::timestamp), $3::text, $1::uuid, $2::text, $7::text, $8::text, $9::text, $10::text, $11::text, $12::text, $13::text
+    WHERE NOT EXISTS (SELECT 1 FROM legacy)
+    ON CONFLICT (feed_id, md5(guid)) DO UPDATE
+    SET title = EXCLUDED.title,
+        description = EXCLUDED.description,
+        published_at = COALESCE($6::timestamp, posts.published_at),
+        url = EXCLUDED.url,
+        content_hash = EXCLUDED.content_hash,
+        author = EXCLUDED.author,
+        content = EXCLUDED.content,
+        comments_url = EXCLUDED.comments_url,
+        source_title = EXCLUDED.source_title,
+        source_url = EXCLUDED.source_url,
+        attachments_hash = EXCLUDED.attachments_hash,
+        updated_at = EXCLUDED.updated_at
+    WHERE posts.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+       OR posts.url IS DISTINCT FROM EXCLUDED.url
+       OR posts.attachments_hash IS DISTINCT FROM EXCLUDED.attachments_hash
+       OR (posts.author, posts.content, posts.comments_url, posts.source_title, posts.source_url)
+          IS DISTINCT FROM (EXCLUDED.author, EXCLUDED.content, EXCLUDED.comments_url, EXCLUDED.source_title, EXCLUDED.source_url)
+    RETURNING posts.id, posts.content_hash
+), revision AS (
+    INSERT INTO post_revisions (post_id, created_at, title, description, published_at, content_hash)
+    SELECT previous.id, $14::timestamp, previous.title, previous.description, previous.published_at, previous.content_hash
+    FROM previous
+    INNER JOIN upserted ON upserted.id = previous.id
+    WHERE previous.content_hash IS NOT NULL
+      AND previous.content_hash IS DISTINCT FROM upserted.content_hash
+)
+SELECT upserted.id FROM upserted
+UNION ALL
+SELECT adopted.id FROM adopted
+`
+
+type UpsertPostParams struct {
+	FeedID          uuid.UUID
+	Guid            string
+	Url             string
+	Title           string
+	Description     string
+	PublishedAt     sql.NullTime
+	ContentHash     sql.NullString
+	Author          string
+	Content         string
+	CommentsUrl     string
+	SourceTitle     string
+	SourceUrl       string
+	AttachmentsHash sql.NullString
+	UpdatedAt       time.Time
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	FetchedAt       time.Time
+}
+
+// Inserts a new item, or rewrites a stored one whose content hash,
+// metadata or attachments changed; only a changed content hash counts as a
+// revision.
+// Items without a usable date are dated fetched_at when first stored and
+// keep their stored date on later updates.
+// A post stored before guids were tracked is adopted instead: when no post
+// has the item's guid yet, a legacy post with the same link takes it over.
+// The version being replaced is copied to post_revisions first; every
+// sub-statement sees the table as it was before the upsert. No row comes
+// back when the stored post was already up to date.
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.FeedID,
+		arg.Guid,
+		arg.Url,
+		arg.Title,
+		arg.Description,
+		arg.PublishedAt,
+		arg.ContentHash,
+		arg.Author,
+		arg.Content,
+		arg.CommentsUrl,
+		arg.SourceTitle,
+		arg.SourceUrl,
+		arg.AttachmentsHash,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.CreatedAt,
+		arg.FetchedAt,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
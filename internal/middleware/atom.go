@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"strings"
+)
+
+type AtomFeed struct {
+	Title    AtomText    `xml:"title"`
+	Subtitle AtomText    `xml:"subtitle"`
+	Links    []AtomLink  `xml:"link"`
+	Entries  []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      AtomText       `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// AtomText holds an Atom text construct. Plain and escaped HTML content is
+// read as character data, while type="xhtml" keeps the inline markup.
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+func (a *AtomFeed) toRSS() *RSSFeed {
+	feed := &RSSFeed{}
+	feed.Channel.Title = a.Title.String()
+	feed.Channel.Link = alternateLink(a.Links)
+	feed.Channel.Description = a.Subtitle.String()
+	for _, entry := range a.Entries {
+		description := entry.Summary.String()
+		if description == "" {
+			description = entry.Content.String()
+		}
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+		var authors []string
+		for _, author := range entry.Authors {
+			if name := strings.TrimSpace(author.Name); name != "" {
+				authors = append(authors, name)
+			}
+		}
+		var categories []string
+		for _, category := range entry.Categories {
+			name := category.Label
+			if name == "" {
+				name = category.Term
+			}
+			categories = append(categories, name)
+		}
+		var enclosures []RSSEnclosure
+		for _, link := range entry.Links {
+			if link.Rel == "enclosure" {
+				enclosures = append(enclosures, RSSEnclosure{URL: link.Href, Type: link.Type, Length: link.Length})
+			}
+		}
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			GUID:        strings.TrimSpace(entry.ID),
+			Title:       entry.Title.String(),
+			Link:        alternateLink(entry.Links),
+			Description: description,
+			Content:     entry.Content.String(),
+			PubDate:     strings.TrimSpace(pubDate),
+			Author:      strings.Join(authors, ", "),
+			Categories:  categories,
+			Enclosures:  enclosures,
+		})
+	}
+	return feed
+}
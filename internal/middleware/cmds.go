@@ -3,16 +3,15 @@ package middleware
 import (
 	"context"
 	"database/sql"
-	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"html"
-	"io"
-	"log"
-	"net/http"
-	"net/url"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/diamondoughnut/gator/internal/config"
@@ -25,6 +24,11 @@ import (
 type State struct {
 	Db *sqlc.Queries
 	CurrentCfg *config.Config
+	// Ctx is cancelled when the process receives SIGINT or SIGTERM.
+	Ctx context.Context
+	Fetcher *Fetcher
+	// Conn is the connection Db wraps, used to start transactions.
+	Conn *sql.DB
 }
 
 type Command struct {
@@ -39,9 +43,15 @@ type Commands struct {
 
 func MiddlewareLoggedIn(handler func(s *State, cmd Command, user sqlc.User) error) func(*State, Command) error {
 	return func(s *State, cmd Command) error {
-		user, err := s.Db.GetUserByName(context.Background(), s.CurrentCfg.CurrentUserName)
+		if s.CurrentCfg.CurrentUserName == "" {
+			return ErrNotLoggedIn
+		}
+		user, err := s.Db.GetUserByName(s.Ctx, s.CurrentCfg.CurrentUserName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: user %q does not exist", ErrNotLoggedIn, sanitizeForLog(s.CurrentCfg.CurrentUserName))
+		}
 		if err != nil {
-			ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 42]: %v", sanitizeForLog(err.Error())))
+			return fmt.Errorf("looking up current user: %w", err)
 		}
 		return handler(s, cmd, user)
 	}
@@ -50,7 +60,7 @@ func MiddlewareLoggedIn(handler func(s *State, cmd Command, user sqlc.User) erro
 func (c *Commands) Run(s *State, cmd Command) error {
 	handler, exists := c.CommandList[cmd.Name]
 	if !exists {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 51]: Command Does Not Exist"))
+		return fmt.Errorf("%w: unknown command %q", ErrInvalidArgument, sanitizeForLog(cmd.Name))
 	}
 	return handler(s, cmd)
 }
@@ -63,19 +73,18 @@ func (c *Commands) Register(name string, execute func(*State, Command) error) {
 }
 
 func HandlerReset(s *State, cmd Command) error {
-	err := s.Db.DropUsers(context.Background())
+	err := s.Db.DropUsers(s.Ctx)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 66]: %v", err))
+		return fmt.Errorf("clearing users: %w", err)
 	}
 	fmt.Println("Users Cleared")
-	syscall.Exit(0)
 	return nil
 }
 
 func HandlerUsers(s *State, cmd Command) error {
-	users, err := s.Db.GetUsers(context.Background(), 10)
+	users, err := s.Db.GetUsers(s.Ctx, 10)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 76]: %v", err))
+		return fmt.Errorf("listing users: %w", err)
 	}
 	for _, user := range users {
 		if s.CurrentCfg.CurrentUserName == user.Name {
@@ -97,10 +106,37 @@ type RSSFeed struct {
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	GUID        string         `xml:"guid"`
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string         `xml:"pubDate"`
+	Author      string         `xml:"author"`
+	Categories  []string       `xml:"category"`
+	Comments    string         `xml:"comments"`
+	Source      RSSSource      `xml:"source"`
+	DCCreator   string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	DCDate      string         `xml:"http://purl.org/dc/elements/1.1/ date"`
+	DCSubjects  []string       `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+	Media
+	ITunes
+}
+
+// RSSSource names the channel an item was republished from.
+type RSSSource struct {
+	URL   string `xml:"url,attr"`
+	Title string `xml:",chardata"`
+}
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+	// Medium and Duration are filled in by normalizeFeed.
+	Medium   string `xml:"-"`
+	Duration int32  `xml:"-"`
 }
 
 func sanitizeForLog(input string) string {
@@ -108,155 +144,262 @@ func sanitizeForLog(input string) string {
 	return strings.ReplaceAll(strings.ReplaceAll(input, "\n", ""), "\r", "")
 }
 
-func validateURL(feedURL string) error {
-	parsedURL, err := url.Parse(feedURL)
+func HandlerAgg(s *State, cmd Command) error {
+	flags := flag.NewFlagSet("agg", flag.ContinueOnError)
+	concurrency := flags.Int("concurrency", 1, "number of feeds to fetch in parallel")
+	batchSize := flags.Int("batch", 0, "number of stalest feeds to fetch per tick (defaults to --concurrency)")
+	once := flags.Bool("once", false, "fetch every due feed once, print a report and exit")
+	args, err := parseFlags(flags, cmd.Args)
 	if err != nil {
-		return fmt.Errorf("invalid URL: %v", err)
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
 	}
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return fmt.Errorf("only HTTP and HTTPS URLs are allowed")
+	if *concurrency < 1 {
+		return fmt.Errorf("%w: concurrency must be at least 1", ErrInvalidArgument)
 	}
-	if strings.Contains(parsedURL.Host, "localhost") || strings.Contains(parsedURL.Host, "127.0.0.1") || strings.Contains(parsedURL.Host, "::1") {
-		return fmt.Errorf("localhost URLs are not allowed")
+	if *batchSize == 0 {
+		*batchSize = *concurrency
 	}
-	return nil
-}
-
-func FetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	if err := validateURL(feedURL); err != nil {
-		return nil, err
+	if *batchSize < 1 {
+		return fmt.Errorf("%w: batch must be at least 1", ErrInvalidArgument)
 	}
- // amazonq-ignore-next-line
-	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
-	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 130]: %v", err))
-		return nil, err
+	if *once {
+		return aggOnce(s, *batchSize, *concurrency)
 	}
-	client := http.Client{
-		Timeout: 30 * time.Second,
+	if len(args) < 1 {
+		return fmt.Errorf("%w: must provide a time interval", ErrInvalidArgument)
 	}
-	res, err := client.Do(req)
+	interval, err := time.ParseDuration(args[0])
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 138]: %v", sanitizeForLog(err.Error())))
-		return nil, err
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
 	}
-	defer res.Body.Close()
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 144]: %v", err))
-		return nil, err
+	if interval < time.Second * 120  {
+		return fmt.Errorf("%w: interval must be at least 2 minutes", ErrInvalidArgument)
 	}
-	feed := &RSSFeed{}
-	err = xml.Unmarshal(data, feed)
-	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 150]: %v", sanitizeForLog(err.Error())))
-		return nil, err
+	session := aggSession{Started: time.Now()}
+	defer session.print()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		results, err := scrapeFeeds(s, *batchSize, *concurrency, 0)
+		session.add(results)
+		if s.Ctx.Err() != nil {
+			fmt.Println("Shutting down aggregator")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case <-s.Ctx.Done():
+			fmt.Println("Shutting down aggregator")
+			return nil
+		case <-ticker.C:
+		}
 	}
-	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
-	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
-	return feed, nil
 }
 
-func HandlerAgg(s *State, cmd Command) error {
-	if len(cmd.Args) < 1 {
-		fmt.Println("Must provide a time interval")
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 161]"))
+// aggOnce claims batches until no due feed is left. Feeds fetched since the
+// pass started are excluded from each claim so every feed is fetched at most
+// once, even when it finishes before the next batch is claimed.
+func aggOnce(s *State, batchSize, concurrency int) error {
+	session := aggSession{Started: time.Now()}
+	defer session.print()
+	var report []scrapeResult
+	for s.Ctx.Err() == nil {
+		minAge := int32(time.Since(session.Started).Seconds()) + 1
+		results, err := scrapeFeeds(s, batchSize, concurrency, minAge)
+		session.add(results)
+		report = append(report, results...)
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			break
+		}
 	}
-	interval, err := time.ParseDuration(cmd.Args[0])
-	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 165]: %v", err))
+	printAggReport(report)
+	// A signal mid-pass leaves due feeds unfetched; cron and CI must not
+	// mistake that for a complete run.
+	if session.Interrupted > 0 || s.Ctx.Err() != nil {
+		return fmt.Errorf("%w: %d feeds were not fetched", ErrInterrupted, session.Interrupted)
 	}
-	if interval < time.Second * 120  {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 168]: Interval must be at least 2 minutes"))
+	if session.Failed > 0 {
+		return fmt.Errorf("%w: %d of %d feeds", ErrFeedsFailed, session.Failed, len(report))
 	}
-	ticker := time.NewTicker(interval)
-	for ; ; <- ticker.C {
-		scrapeFeeds(s)
+	return nil
+}
+
+func printAggReport(report []scrapeResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FEED\tNEW\tUPDATED\tSKIPPED\tSTATUS")
+	for _, result := range report {
+		status := "ok"
+		switch {
+		case result.Interrupted:
+			status = "interrupted"
+		case result.Err != nil:
+			status = "error: " + sanitizeForLog(result.Err.Error())
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", sanitizeForLog(result.Feed.Name), result.NewPosts, result.Updated, result.Skipped, status)
 	}
+	w.Flush()
+}
+
+// aggSession totals what a single run of agg did, printed on exit.
+type aggSession struct {
+	Started     time.Time
+	Ticks       int
+	Feeds       int
+	NewPosts    int
+	Updated     int
+	Skipped     int
+	Failed      int
+	Interrupted int
+}
+
+func (a *aggSession) add(results []scrapeResult) {
+	a.Ticks++
+	for _, result := range results {
+		switch {
+		case result.Interrupted:
+			a.Interrupted++
+		case result.Err != nil:
+			a.Failed++
+		default:
+			a.Feeds++
+			a.NewPosts += result.NewPosts
+			a.Updated += result.Updated
+			a.Skipped += result.Skipped
+		}
+	}
+}
+
+func (a *aggSession) print() {
+	fmt.Printf("Session summary (%v): %d ticks, %d feeds scraped, %d new posts, %d updated, %d skipped, %d failed, %d interrupted\n",
+		time.Since(a.Started).Round(time.Second), a.Ticks, a.Feeds, a.NewPosts, a.Updated, a.Skipped, a.Failed, a.Interrupted)
 }
 
 func HandlerAddFeed(s *State, cmd Command, user sqlc.User) error {
 	if len(cmd.Args) < 2 {
-		fmt.Println("Must provide name and url")
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 179]"))
+		return fmt.Errorf("%w: must provide name and url", ErrInvalidArgument)
 	}
 	name := cmd.Args[0]
 	url := cmd.Args[1]
 
-	if err := validateURL(url); err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 185]: %v", err))
+	if err := s.Fetcher.validateURL(url); err != nil {
+		return err
 	}
 
-	newFeed, err := s.Db.CreateFeed(context.Background(), sqlc.CreateFeedParams{Name: name, Url: url, UserID: user.ID})
+	newFeed, err := s.Db.CreateFeed(s.Ctx, sqlc.CreateFeedParams{Name: name, Url: url, UserID: user.ID})
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "violates unique constraint") || strings.Contains(err.Error(), "feeds_pkey") {
-			_, err = s.Db.CreateFeedFollow(context.Background(), sqlc.CreateFeedFollowParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedUrl: url})
+		if isUniqueViolation(err) {
+			existing, err := s.Db.GetFeedByUrl(s.Ctx, url)
 			if err != nil {
-				if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "violates unique constraint") {
+				return fmt.Errorf("looking up feed: %w", err)
+			}
+			_, err = s.Db.CreateFeedFollow(s.Ctx, sqlc.CreateFeedFollowParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedID: existing.ID})
+			if err != nil {
+				if isUniqueViolation(err) {
 					fmt.Printf("Already following this feed\n")
 					return nil
 				}
-				ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 197]: %v", err))
+				return fmt.Errorf("following feed: %w", err)
 			}
 			fmt.Printf("Feed already exists - Followed\n")
 			return nil
 		}
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 202]: %v", err))
+		return fmt.Errorf("creating feed: %w", err)
 	}
-	_, err = s.Db.CreateFeedFollow(context.Background(), sqlc.CreateFeedFollowParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedUrl: newFeed.Url})
+	_, err = s.Db.CreateFeedFollow(s.Ctx, sqlc.CreateFeedFollowParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedID: newFeed.ID})
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 206]: %v", err))
+		return fmt.Errorf("following feed: %w", err)
 	}
 	fmt.Printf("Feed created and followed: %s\n", name)
 	return nil
 }
 
 func HandlerFeeds(s *State, cmd Command) error {
-	feeds, err := s.Db.GetFeeds(context.Background())
+	feeds, err := s.Db.GetFeeds(s.Ctx)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 215]: %v", err))
+		return fmt.Errorf("listing feeds: %w", err)
 	}
 	for _, feed := range feeds {
-		user, err := s.Db.GetUser(context.Background(), feed.UserID)
+		user, err := s.Db.GetUser(s.Ctx, feed.UserID)
 		if err != nil {
-			ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 220]: %v", err))
+			return fmt.Errorf("looking up owner of %s: %w", feed.Url, err)
 		}
 		fmt.Println(feed.Name)
 		fmt.Println(feed.Url)
+		fmt.Println(feed.ID)
 		fmt.Println(user.Name)
+		if feed.DeadAt.Valid {
+			fmt.Printf("Dead since %v: %s\n", feed.DeadAt.Time, feed.LastError)
+		} else if feed.ConsecutiveFailures > 0 {
+			fmt.Printf("Failing (%d in a row): %s\n", feed.ConsecutiveFailures, feed.LastError)
+			fmt.Printf("Next attempt: %v\n", feed.NextFetchAt.Time)
+		}
 	}
 	return nil
 }
 
+// resolveFeed finds a feed by ID, URL or name. Names are not unique, so a
+// name matching several feeds is rejected and the user must pick by ID or URL.
+func resolveFeed(s *State, ref string) (sqlc.Feed, error) {
+	var feed sqlc.Feed
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		feed, err = s.Db.GetFeedByID(s.Ctx, id)
+	} else if strings.Contains(ref, "://") {
+		feed, err = s.Db.GetFeedByUrl(s.Ctx, ref)
+	} else {
+		var feeds []sqlc.Feed
+		feeds, err = s.Db.GetFeedsByName(s.Ctx, ref)
+		if err != nil {
+			return sqlc.Feed{}, fmt.Errorf("looking up feed: %w", err)
+		}
+		switch len(feeds) {
+		case 0:
+			err = sql.ErrNoRows
+		case 1:
+			return feeds[0], nil
+		default:
+			return sqlc.Feed{}, fmt.Errorf("%w: %d feeds are named %q, use the feed's ID or URL", ErrInvalidArgument, len(feeds), sanitizeForLog(ref))
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return sqlc.Feed{}, fmt.Errorf("%w: feed %q", ErrNotFound, sanitizeForLog(ref))
+	}
+	if err != nil {
+		return sqlc.Feed{}, fmt.Errorf("looking up feed: %w", err)
+	}
+	return feed, nil
+}
+
 func HandlerFollow(s *State, cmd Command, user sqlc.User) error {
 	if len(cmd.Args) < 1 {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 231]"))
-	}
-	if s.CurrentCfg.CurrentUserName == "" {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 234]"))
+		return fmt.Errorf("%w: must provide a feed ID, name or url", ErrInvalidArgument)
 	}
-	
-	feed, err := s.Db.GetFeedByUrl(context.Background(), cmd.Args[0])
+
+	feed, err := resolveFeed(s, cmd.Args[0])
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 239]: %v", err))
+		return err
 	}
-	_, err = s.Db.CreateFeedFollow(context.Background(), sqlc.CreateFeedFollowParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedUrl: feed.Url})
+	_, err = s.Db.CreateFeedFollow(s.Ctx, sqlc.CreateFeedFollowParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), UserID: user.ID, FeedID: feed.ID})
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "violates unique constraint") {
+		if isUniqueViolation(err) {
 			fmt.Printf("Already following this feed\n")
 			return nil
 		}
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 247]: %v", err))
+		return fmt.Errorf("following feed: %w", err)
 	}
 	fmt.Printf("Feed: %v\nUser: %v\n", feed.Name, user.Name)
 	return nil
 }
 
 func HandlerFollowing(s *State, cmd Command, user sqlc.User) error {
-	
-	follows, err := s.Db.GetFeedFollowsForUser(context.Background(), user.ID)
+	follows, err := s.Db.GetFeedFollowsForUser(s.Ctx, user.ID)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 257]: %v", err))
+		return fmt.Errorf("listing follows: %w", err)
 	}
 	for _, follow := range follows {
 		fmt.Println(follow.FeedName)
@@ -266,17 +409,20 @@ func HandlerFollowing(s *State, cmd Command, user sqlc.User) error {
 
 func HandlerLogin(s *State, cmd Command) error {
 	if len(cmd.Args) < 1 {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 267]"))
+		return fmt.Errorf("%w: must provide a username", ErrInvalidArgument)
 	}
 	usr := cmd.Args[0]
-	_, err := s.Db.GetUserByName(context.Background(), usr)
+	_, err := s.Db.GetUserByName(s.Ctx, usr)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: user %q", ErrNotFound, sanitizeForLog(usr))
+	}
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 272]: %v", err))
+		return fmt.Errorf("looking up user: %w", err)
 	}
 	s.CurrentCfg.CurrentUserName = usr
 	err = config.SetUser(usr)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 277]: %v", err))
+		return fmt.Errorf("saving config: %w", err)
 	}
 	fmt.Println("Logged in as", usr)
 	return nil
@@ -284,22 +430,25 @@ func HandlerLogin(s *State, cmd Command) error {
 
 func HandlerRegister(s *State, cmd Command) error {
 	if len(cmd.Args) < 1 {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 285]"))
+		return fmt.Errorf("%w: must provide a username", ErrInvalidArgument)
 	}
 	usr := cmd.Args[0]
-	_, err := s.Db.GetUserByName(context.Background(), usr)
+	_, err := s.Db.GetUserByName(s.Ctx, usr)
 	if err == nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 290]: %v", err))
+		return fmt.Errorf("%w: user %q", ErrAlreadyExists, sanitizeForLog(usr))
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("looking up user: %w", err)
 	}
-	_, err = s.Db.CreateUser(context.Background(), sqlc.CreateUserParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Name: usr})
+	_, err = s.Db.CreateUser(s.Ctx, sqlc.CreateUserParams{ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Name: usr})
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 294]: %v", err))
+		return fmt.Errorf("creating user: %w", err)
 	}
 	fmt.Println("Registered user:", usr)
 	s.CurrentCfg.CurrentUserName = usr
 	err = config.SetUser(usr)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 300]: %v", err))
+		return fmt.Errorf("saving config: %w", err)
 	}
 	fmt.Println("Logged in as", usr)
 	return nil
@@ -307,102 +456,660 @@ func HandlerRegister(s *State, cmd Command) error {
 
 func HandlerUnfollow(s *State, cmd Command, user sqlc.User) error {
 	if len(cmd.Args) < 1 {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 308]"))
+		return fmt.Errorf("%w: must provide a feed ID, name or url", ErrInvalidArgument)
 	}
-	err := s.Db.DeleteFeedFollowByUserAndFeedUrl(context.Background(), sqlc.DeleteFeedFollowByUserAndFeedUrlParams{UserID: user.ID, FeedUrl: cmd.Args[0]})
+	feed, err := resolveFeed(s, cmd.Args[0])
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 312]: %v", err))
+		return err
+	}
+	deleted, err := s.Db.DeleteFeedFollowByUserAndFeed(s.Ctx, sqlc.DeleteFeedFollowByUserAndFeedParams{UserID: user.ID, FeedID: feed.ID})
+	if err != nil {
+		return fmt.Errorf("unfollowing feed: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: not following %q", ErrNotFound, sanitizeForLog(cmd.Args[0]))
 	}
 	return nil
 }
 
-func scrapeFeeds(s *State) {
-	feed, err := s.Db.GetNextFeedToFetch(context.Background())
+type scrapeResult struct {
+	Feed        sqlc.Feed
+	NewPosts    int
+	Updated     int
+	Skipped     int
+	Err         error
+	Interrupted bool
+}
+
+// feedClaimLease is how long a claimed feed stays reserved for this process.
+// If the process dies mid-batch the lease expires and another aggregator
+// picks the feed up.
+const feedClaimLease = 10 * time.Minute
+
+func scrapeFeeds(s *State, batchSize, concurrency int, minAgeSeconds int32) ([]scrapeResult, error) {
+	feeds, err := s.Db.ClaimFeedsToFetch(s.Ctx, sqlc.ClaimFeedsToFetchParams{LeaseSeconds: int32(feedClaimLease.Seconds()), MinAgeSeconds: minAgeSeconds, BatchSize: int32(batchSize)})
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 320]: %v", err))
+		return nil, fmt.Errorf("claiming feeds: %w", err)
+	}
+
+	jobs := make(chan sqlc.Feed)
+	results := make(chan scrapeResult, len(feeds))
+	var wg sync.WaitGroup
+	for i := 0; i < min(concurrency, len(feeds)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for feed := range jobs {
+				if s.Ctx.Err() != nil {
+					releaseFeedClaim(s, feed)
+					results <- scrapeResult{Feed: feed, Interrupted: true}
+					continue
+				}
+				result := scrapeFeed(s, feed)
+				// A feed merged into another during the fetch hands its
+				// posts to a feed this worker never claimed, so only the
+				// claimed feed's claim may be released.
+				claimed := result.Feed.ID == feed.ID
+				if s.Ctx.Err() != nil {
+					// Leave partially processed feeds due so the next run picks them up.
+					releaseFeedClaim(s, feed)
+					result.Interrupted = true
+				} else if isGone(result.Err) {
+					fmt.Printf("Feed %s is gone, marking it dead\n", sanitizeForLog(feed.Name))
+					err := s.Db.MarkFeedDead(s.Ctx, sqlc.MarkFeedDeadParams{ID: result.Feed.ID, LastError: sanitizeForLog(result.Err.Error())})
+					if err != nil {
+						fmt.Printf("Failed to mark %s dead: %v\n", sanitizeForLog(feed.Name), sanitizeForLog(err.Error()))
+					}
+				} else if result.Err != nil {
+					err := s.Db.RecordFeedFailure(s.Ctx, sqlc.RecordFeedFailureParams{ID: result.Feed.ID, LastError: sanitizeForLog(result.Err.Error()), ReleaseClaim: claimed})
+					if err != nil {
+						fmt.Printf("Failed to record failure for %s: %v\n", sanitizeForLog(feed.Name), sanitizeForLog(err.Error()))
+					}
+				} else {
+					result.Err = s.Db.MarkFeedFetched(s.Ctx, sqlc.MarkFeedFetchedParams{ID: result.Feed.ID, ReleaseClaim: claimed})
+				}
+				results <- result
+			}
+		}()
+	}
+	for _, feed := range feeds {
+		jobs <- feed
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	var newPosts, failed int
+	var scraped []scrapeResult
+	for result := range results {
+		scraped = append(scraped, result)
+		name := sanitizeForLog(result.Feed.Name)
+		if result.Interrupted {
+			fmt.Printf("Interrupted %s\n", name)
+			continue
+		}
+		if result.Err != nil {
+			failed++
+			fmt.Printf("Failed to scrape %s: %v\n", name, sanitizeForLog(result.Err.Error()))
+			continue
+		}
+		newPosts += result.NewPosts
+		fmt.Printf("Scraped %s: %d new, %d updated, %d skipped\n", name, result.NewPosts, result.Updated, result.Skipped)
 	}
-	err = s.Db.MarkFeedFetched(context.Background(), feed.Url)
+	fmt.Printf("Cycling feed scraper: %d feeds, %d new posts, %d failed\n", len(feeds), newPosts, failed)
+	return scraped, nil
+}
+
+// releaseFeedClaim hands a claimed feed back without marking it fetched. It
+// runs on its own context because s.Ctx is usually already cancelled here.
+func releaseFeedClaim(s *State, feed sqlc.Feed) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.Db.ReleaseFeedClaim(ctx, feed.ID)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 324]: %v", err))
+		fmt.Printf("Failed to release %s: %v\n", sanitizeForLog(feed.Name), sanitizeForLog(err.Error()))
 	}
-	feedData, err := FetchFeed(context.Background(), feed.Url)
+}
+
+func scrapeFeed(s *State, feed sqlc.Feed) scrapeResult {
+	result := scrapeResult{Feed: feed}
+	fetched, err := s.Fetcher.FetchFeed(s.Ctx, feed.Url, feed.Etag, feed.LastModified)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 328]: %v", err))
+		result.Err = err
+		return result
 	}
-	feedItems := feedData.Channel.Item
+	if fetched.MovedTo != "" {
+		if err := s.Fetcher.validateURL(fetched.MovedTo); err != nil {
+			result.Err = err
+			return result
+		}
+		moved, err := moveFeed(s, feed, fetched.MovedTo)
+		if err != nil {
+			result.Err = fmt.Errorf("moving feed to %s: %w", sanitizeForLog(fetched.MovedTo), err)
+			return result
+		}
+		fmt.Printf("Feed %s moved permanently: %s -> %s\n", sanitizeForLog(feed.Name), sanitizeForLog(feed.Url), sanitizeForLog(fetched.MovedTo))
+		feed = moved
+		result.Feed = feed
+	}
+	if fetched.NotModified {
+		return result
+	}
+	feedItems := fetched.Feed.Channel.Item
 	for _, item := range feedItems {
 		title := item.Title
 		url := item.Link
 		description := item.Description
-		var published_at_xml XMLtime
-		err := xml.Unmarshal([]byte(item.PubDate), &published_at_xml)
+		published, ok := parsePubDate(item.PubDate)
+		published_at := sql.NullTime{Time: published, Valid: ok}
+		feed_id := feed.ID
+
+		id := uuid.New()
+		now := time.Now().UTC()
+		contentHash := sql.NullString{String: itemContentHash(item), Valid: true}
+		postID, err := s.Db.UpsertPost(s.Ctx, sqlc.UpsertPostParams{
+			ID:              id,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			Title:           title,
+			Url:             url,
+			Description:     description,
+			PublishedAt:     published_at,
+			FetchedAt:       now,
+			FeedID:          feed_id,
+			Guid:            itemGUID(item),
+			ContentHash:     contentHash,
+			Author:          strings.TrimSpace(item.Author),
+			Content:         item.Content,
+			CommentsUrl:     strings.TrimSpace(item.Comments),
+			SourceTitle:     strings.TrimSpace(item.Source.Title),
+			SourceUrl:       strings.TrimSpace(item.Source.URL),
+			AttachmentsHash: sql.NullString{String: itemAttachmentsHash(item), Valid: true},
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			result.Skipped++
+			continue
+		}
 		if err != nil {
-			if err != io.EOF {
-				ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 340]: %v", err))
-			}
+			result.Err = err
+			return result
 		}
-		published_at := sql.NullTime{Time: published_at_xml.Time, Valid: !published_at_xml.Time.IsZero()}
-		feed_url := feed.Url
-		
-		_, err = s.Db.CreatePost(context.Background(), sqlc.CreatePostParams{CreatedAt: time.Now(), UpdatedAt: time.Now(), Title: title, Url: url, Description: description, PublishedAt: published_at, FeedUrl: feed_url})
+		err = s.Db.SetPostCategories(s.Ctx, sqlc.SetPostCategoriesParams{PostID: postID, Names: item.Categories})
 		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "violates unique constraint") {
-				continue
-			}
-			ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 352]: %v", err))
+			result.Err = fmt.Errorf("saving categories: %w", err)
+			return result
+		}
+		err = s.Db.SetPostEnclosures(s.Ctx, enclosureParams(postID, item.Enclosures))
+		if err != nil {
+			result.Err = fmt.Errorf("saving enclosures: %w", err)
+			return result
+		}
+		if postID != id {
+			result.Updated++
+			continue
 		}
+		result.NewPosts++
 	}
-	fmt.Println("Cycling feed scraper")
+	// Only remember the validators once every item is stored, otherwise a
+	// later 304 would hide the items we never got to.
+	err = s.Db.UpdateFeedCacheHeaders(s.Ctx, sqlc.UpdateFeedCacheHeadersParams{ID: feed.ID, Etag: fetched.ETag, LastModified: fetched.LastModified})
+	if err != nil {
+		result.Err = err
+	}
+	return result
 }
 
 func HandlerBrowse(s *State, cmd Command, user sqlc.User) error {
-	var limit int
-	if len(cmd.Args) < 1 {
-		limit = 2
-	} else {
-		limit, _ = strconv.Atoi(cmd.Args[0])
+	flags := flag.NewFlagSet("browse", flag.ContinueOnError)
+	details := flags.Bool("details", false, "show author, categories, comments and source")
+	content := flags.Bool("content", false, "show the full content instead of the description")
+	author := flags.String("author", "", "only show posts whose author contains this text")
+	category := flags.String("category", "", "only show posts in this category")
+	mediaKind := flags.String("media", "", "only show posts with audio, video or any (audio or video) attachments")
+	includeRead := flags.Bool("all", false, "include posts already marked read")
+	feedRef := flags.String("feed", "", "only show posts from this feed (ID, name or URL)")
+	since := flags.String("since", "", "only show posts published at or after this age (7d, 36h) or date")
+	until := flags.String("until", "", "only show posts published before this age (7d, 36h) or date")
+	sortBy := flags.String("sort", "published", "order posts by published, fetched or feed")
+	offset := flags.Int("offset", 0, "skip this many posts")
+	cursor := flags.String("cursor", "", "continue after the page that printed this cursor")
+	args, err := parseFlags(flags, cmd.Args)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	params := sqlc.GetPostsForUserParams{
+		UserID:      user.ID,
+		IncludeRead: *includeRead,
+		Author:      sql.NullString{String: *author, Valid: *author != ""},
+		Category:    sql.NullString{String: *category, Valid: *category != ""},
+		Limit:       2,
+	}
+	switch *mediaKind {
+	case "":
+	case "audio", "video":
+		params.Media = []string{*mediaKind}
+	case "any":
+		params.Media = []string{"audio", "video"}
+	default:
+		return fmt.Errorf("%w: media must be audio, video or any", ErrInvalidArgument)
+	}
+	switch *sortBy {
+	case "published", "fetched", "feed":
+		params.SortBy = *sortBy
+	default:
+		return fmt.Errorf("%w: sort must be published, fetched or feed", ErrInvalidArgument)
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("%w: unexpected argument %q", ErrInvalidArgument, sanitizeForLog(args[1]))
+	}
+	if len(args) == 1 {
+		limit, err := strconv.Atoi(args[0])
+		if err != nil || limit < 1 || limit > 1000 {
+			return fmt.Errorf("%w: limit must be a number from 1 to 1000", ErrInvalidArgument)
+		}
+		params.Limit = int32(limit)
+	}
+	if *offset < 0 {
+		return fmt.Errorf("%w: offset must not be negative", ErrInvalidArgument)
+	}
+	params.Offset = int32(*offset)
+	if *cursor != "" {
+		if *offset != 0 {
+			return fmt.Errorf("%w: use either --offset or --cursor", ErrInvalidArgument)
+		}
+		c, err := parseBrowseCursor(*cursor)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+		}
+		if c.Sort != params.SortBy {
+			return fmt.Errorf("%w: cursor is for --sort %s", ErrInvalidArgument, c.Sort)
+		}
+		c.apply(&params)
+	}
+	if *feedRef != "" {
+		feed, err := resolveFeed(s, *feedRef)
+		if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	now := time.Now()
+	if *since != "" {
+		t, err := parseCutoff(*since, now)
+		if err != nil {
+			return fmt.Errorf("%w: since: %v", ErrInvalidArgument, err)
+		}
+		params.Since = sql.NullTime{Time: t, Valid: true}
+	}
+	if *until != "" {
+		t, err := parseCutoff(*until, now)
+		if err != nil {
+			return fmt.Errorf("%w: until: %v", ErrInvalidArgument, err)
+		}
+		params.Until = sql.NullTime{Time: t, Valid: true}
 	}
-	posts, err := s.Db.GetPostsForUser(context.Background(), sqlc.GetPostsForUserParams{UserID: user.ID, Limit: int32(limit)})
+	if params.Since.Valid && params.Until.Valid && !params.Since.Time.Before(params.Until.Time) {
+		return fmt.Errorf("%w: since must be before until", ErrInvalidArgument)
+	}
+	posts, err := s.Db.GetPostsForUser(s.Ctx, params)
 	if err != nil {
-		ThrowError(fmt.Errorf("[GATOR: CMDS.GO: LINE 365]: %v", err))
+		return fmt.Errorf("listing posts: %w", err)
 	}
+	postIDs := make([]uuid.UUID, 0, len(posts))
 	for _, post := range posts {
-		fmt.Println(post.Title)
+		postIDs = append(postIDs, post.ID)
+	}
+	enclosures, err := s.Db.GetEnclosuresForPosts(s.Ctx, postIDs)
+	if err != nil {
+		return fmt.Errorf("listing enclosures: %w", err)
+	}
+	enclosuresByPost := make(map[uuid.UUID][]sqlc.PostEnclosure)
+	for _, enclosure := range enclosures {
+		enclosuresByPost[enclosure.PostID] = append(enclosuresByPost[enclosure.PostID], enclosure)
+	}
+	for _, post := range posts {
+		if post.Read {
+			fmt.Printf("[read] %s\n", post.Title)
+		} else {
+			fmt.Println(post.Title)
+		}
 		fmt.Println(post.Url)
-		fmt.Println(post.Description)
+		if *content && post.Content != "" {
+			fmt.Println(post.Content)
+		} else {
+			fmt.Println(post.Description)
+		}
 		fmt.Println(post.PublishedAt.Time)
+		fmt.Println(post.FeedName)
 		fmt.Println(post.FeedUrl)
+		fmt.Printf("ID: %s\n", post.ID)
+		if *details {
+			printPostDetails(post)
+		}
+		for _, enclosure := range enclosuresByPost[post.ID] {
+			printEnclosure(enclosure)
+		}
 		fmt.Println()
 	}
+	if len(posts) == int(params.Limit) {
+		fmt.Printf("More posts: repeat with --cursor %s\n", newBrowseCursor(params.SortBy, posts[len(posts)-1]))
+	}
 	return nil
 }
 
-type XMLtime struct {
-	time.Time
+// printEnclosure shows an attachment's URL followed by whichever of its
+// type, size and running time the feed gave.
+func printEnclosure(enclosure sqlc.PostEnclosure) {
+	var info []string
+	if enclosure.MimeType != "" {
+		info = append(info, enclosure.MimeType)
+	} else if enclosure.Medium != "" {
+		info = append(info, enclosure.Medium)
+	}
+	if enclosure.Length > 0 {
+		info = append(info, fmt.Sprintf("%.1f MB", float64(enclosure.Length)/(1<<20)))
+	}
+	if enclosure.DurationSeconds > 0 {
+		info = append(info, (time.Duration(enclosure.DurationSeconds) * time.Second).String())
+	}
+	if len(info) == 0 {
+		fmt.Printf("Attachment: %s\n", enclosure.Url)
+		return
+	}
+	fmt.Printf("Attachment: %s (%s)\n", enclosure.Url, strings.Join(info, ", "))
 }
 
-func (t *XMLtime) UnmarshalText(text []byte) error {
-	formats := []string{
-		"2006-01-02T15:04:05Z07:00", 
-		"2006-01-02",                
-		"01/02/2006",                
-		"02-Jan-06",
-		"Tue, 02 Sep 2025 04:30:00 +0000",
+func printPostDetails(post sqlc.GetPostsForUserRow) {
+	if post.Author != "" {
+		fmt.Printf("Author: %s\n", post.Author)
+	}
+	if len(post.Categories) > 0 {
+		fmt.Printf("Categories: %s\n", strings.Join(post.Categories, ", "))
+	}
+	if post.CommentsUrl != "" {
+		fmt.Printf("Comments: %s\n", post.CommentsUrl)
+	}
+	if post.SourceTitle != "" || post.SourceUrl != "" {
+		fmt.Printf("Source: %s %s\n", post.SourceTitle, post.SourceUrl)
 	}
+}
 
-	dateStr := strings.TrimSpace(string(text))
+// HandlerRead marks posts as read: one post by ID or URL, every post in a
+// feed with --feed, every post older than --older-than, or a combination.
+func HandlerRead(s *State, cmd Command, user sqlc.User) error {
+	return markPosts(s, cmd, user, true)
+}
 
-	for _, f := range formats {
-		parsedTime, err := time.Parse(f, dateStr)
-		if err == nil {
-			*t = XMLtime{parsedTime}
-			return nil
+// HandlerUnread is the inverse of HandlerRead and takes the same arguments.
+func HandlerUnread(s *State, cmd Command, user sqlc.User) error {
+	return markPosts(s, cmd, user, false)
+}
+
+func markPosts(s *State, cmd Command, user sqlc.User, read bool) error {
+	flags := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	feedRef := flags.String("feed", "", "only posts in this feed (ID, name or URL)")
+	olderThan := flags.String("older-than", "", "only posts published before this age (7d, 36h) or date")
+	args, err := parseFlags(flags, cmd.Args)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	if len(args) == 0 && *feedRef == "" && *olderThan == "" {
+		return fmt.Errorf("%w: must provide a post ID or URL, --feed or --older-than", ErrInvalidArgument)
+	}
+	var postID uuid.NullUUID
+	var postURL sql.NullString
+	if len(args) > 0 {
+		postID, postURL, err = parsePostRef(args[0])
+		if err != nil {
+			return err
+		}
+	}
+	var feedID uuid.NullUUID
+	if *feedRef != "" {
+		feed, err := resolveFeed(s, *feedRef)
+		if err != nil {
+			return err
+		}
+		feedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	var cutoff sql.NullTime
+	if *olderThan != "" {
+		t, err := parseCutoff(*olderThan, time.Now())
+		if err != nil {
+			return fmt.Errorf("%w: older-than: %v", ErrInvalidArgument, err)
 		}
+		cutoff = sql.NullTime{Time: t, Valid: true}
+	}
+
+	var marked int64
+	if read {
+		marked, err = s.Db.MarkPostsRead(s.Ctx, sqlc.MarkPostsReadParams{ReadAt: time.Now().UTC(), UserID: user.ID, PostID: postID, Url: postURL, FeedID: feedID, OlderThan: cutoff})
+	} else {
+		marked, err = s.Db.MarkPostsUnread(s.Ctx, sqlc.MarkPostsUnreadParams{UserID: user.ID, PostID: postID, Url: postURL, FeedID: feedID, OlderThan: cutoff})
+	}
+	if err != nil {
+		return fmt.Errorf("marking posts: %w", err)
+	}
+	state := "unread"
+	if read {
+		state = "read"
+	}
+	fmt.Printf("Marked %d posts as %s\n", marked, state)
+	return nil
+}
+
+// parsePostRef reads a post given by ID or by URL. Since feeds can share
+// a link, a URL may match more than one post.
+func parsePostRef(ref string) (uuid.NullUUID, sql.NullString, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return uuid.NullUUID{UUID: id, Valid: true}, sql.NullString{}, nil
+	}
+	if strings.Contains(ref, "://") {
+		return uuid.NullUUID{}, sql.NullString{String: ref, Valid: true}, nil
 	}
+	return uuid.NullUUID{}, sql.NullString{}, fmt.Errorf("%w: %q is not a post ID or URL", ErrInvalidArgument, sanitizeForLog(ref))
+}
 
-	return fmt.Errorf("unable to parse date: %s", dateStr)
+// parseTags splits a comma-separated tag list, lowercasing each tag and
+// dropping blanks and repeats.
+func parseTags(value string) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
 }
 
-func ThrowError(err error) {
-	log.Fatal(err)
+// HandlerStar saves a post for later, optionally with a note and tags.
+// Starring an already starred post replaces whichever of the two are given.
+func HandlerStar(s *State, cmd Command, user sqlc.User) error {
+	flags := flag.NewFlagSet("star", flag.ContinueOnError)
+	note := flags.String("note", "", "free-text note to keep with the post")
+	tags := flags.String("tags", "", "comma-separated tags")
+	args, err := parseFlags(flags, cmd.Args)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	if len(args) < 1 {
+		return fmt.Errorf("%w: must provide a post ID or URL", ErrInvalidArgument)
+	}
+	postID, postURL, err := parsePostRef(args[0])
+	if err != nil {
+		return err
+	}
+	params := sqlc.StarPostsParams{StarredAt: time.Now().UTC(), UserID: user.ID, PostID: postID, Url: postURL}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "note":
+			params.Note = sql.NullString{String: *note, Valid: true}
+		case "tags":
+			params.Tags = parseTags(*tags)
+		}
+	})
+	starred, err := s.Db.StarPosts(s.Ctx, params)
+	if err != nil {
+		return fmt.Errorf("starring post: %w", err)
+	}
+	if starred == 0 {
+		return fmt.Errorf("%w: no post %q in feeds you follow", ErrNotFound, sanitizeForLog(args[0]))
+	}
+	fmt.Printf("Starred %d posts\n", starred)
+	return nil
+}
+
+func HandlerUnstar(s *State, cmd Command, user sqlc.User) error {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("%w: must provide a post ID or URL", ErrInvalidArgument)
+	}
+	postID, postURL, err := parsePostRef(cmd.Args[0])
+	if err != nil {
+		return err
+	}
+	unstarred, err := s.Db.UnstarPosts(s.Ctx, sqlc.UnstarPostsParams{UserID: user.ID, PostID: postID, Url: postURL})
+	if err != nil {
+		return fmt.Errorf("unstarring post: %w", err)
+	}
+	if unstarred == 0 {
+		return fmt.Errorf("%w: no starred post %q", ErrNotFound, sanitizeForLog(cmd.Args[0]))
+	}
+	fmt.Printf("Unstarred %d posts\n", unstarred)
+	return nil
+}
+
+// HandlerStarred lists the user's starred posts, most recently starred
+// first, optionally only those with a given tag.
+func HandlerStarred(s *State, cmd Command, user sqlc.User) error {
+	flags := flag.NewFlagSet("starred", flag.ContinueOnError)
+	tag := flags.String("tag", "", "only show posts with this tag")
+	args, err := parseFlags(flags, cmd.Args)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	limit := 20
+	if len(args) > 0 {
+		limit, err = strconv.Atoi(args[0])
+		if err != nil || limit < 1 {
+			return fmt.Errorf("%w: limit must be a positive number", ErrInvalidArgument)
+		}
+	}
+	normalizedTag := strings.ToLower(strings.TrimSpace(*tag))
+	posts, err := s.Db.GetStarredPostsForUser(s.Ctx, sqlc.GetStarredPostsForUserParams{
+		UserID: user.ID,
+		Tag:    sql.NullString{String: normalizedTag, Valid: normalizedTag != ""},
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return fmt.Errorf("listing starred posts: %w", err)
+	}
+	for _, post := range posts {
+		fmt.Println(post.Title)
+		fmt.Println(post.Url)
+		fmt.Println(post.FeedName)
+		fmt.Printf("ID: %s\n", post.ID)
+		fmt.Printf("Starred: %v\n", post.StarredAt)
+		if len(post.Tags) > 0 {
+			fmt.Printf("Tags: %s\n", strings.Join(post.Tags, ", "))
+		}
+		if post.Note != "" {
+			fmt.Printf("Note: %s\n", post.Note)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// searchQuery joins the search arguments into one web search query. An
+// argument the shell kept together, such as "error handling", is searched
+// as a phrase unless it already uses query syntax: quotes, OR or -word.
+func searchQuery(args []string) string {
+	terms := make([]string, 0, len(args))
+	for _, arg := range args {
+		words := strings.Fields(arg)
+		phrase := len(words) > 1 && !strings.Contains(arg, "\"")
+		for _, word := range words {
+			if strings.HasPrefix(word, "-") || strings.EqualFold(word, "or") {
+				phrase = false
+			}
+		}
+		if phrase {
+			arg = "\"" + strings.Join(words, " ") + "\""
+		}
+		terms = append(terms, arg)
+	}
+	return strings.TrimSpace(strings.Join(terms, " "))
+}
+
+// HandlerSearch runs a full-text search over posts in the user's followed
+// feeds. Arguments are joined into one web search query; an argument with
+// spaces, such as one quoted on the shell, is searched as a phrase:
+//
+//	search go "error handling" -rust
+func HandlerSearch(s *State, cmd Command, user sqlc.User) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := flags.Int("limit", 10, "maximum number of results")
+	args, err := parseQueryFlags(flags, cmd.Args)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	if *limit < 1 || *limit > 1000 {
+		return fmt.Errorf("%w: limit must be a number from 1 to 1000", ErrInvalidArgument)
+	}
+	query := searchQuery(args)
+	if query == "" {
+		return fmt.Errorf("%w: must provide a search query", ErrInvalidArgument)
+	}
+	results, err := s.Db.SearchPostsForUser(s.Ctx, sqlc.SearchPostsForUserParams{Query: query, UserID: user.ID, Limit: int32(*limit)})
+	if err != nil {
+		return fmt.Errorf("searching posts: %w", err)
+	}
+	if len(results) == 0 {
+		fmt.Println("No matching posts")
+		return nil
+	}
+	for _, result := range results {
+		fmt.Println(result.Title)
+		fmt.Println(result.Url)
+		fmt.Println(strings.Join(strings.Fields(result.Snippet), " "))
+		fmt.Println(result.PublishedAt.Time)
+		fmt.Println(result.FeedName)
+		fmt.Printf("ID: %s\n", result.ID)
+		fmt.Println()
+	}
+	return nil
+}
+
+// HandlerHistory lists the earlier versions of a post that the publisher
+// has since edited.
+func HandlerHistory(s *State, cmd Command, user sqlc.User) error {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("%w: must provide a post ID or URL", ErrInvalidArgument)
+	}
+	postID, postURL, err := parsePostRef(cmd.Args[0])
+	if err != nil {
+		return err
+	}
+	revisions, err := s.Db.GetPostRevisionsForUser(s.Ctx, sqlc.GetPostRevisionsForUserParams{UserID: user.ID, PostID: postID, Url: postURL})
+	if err != nil {
+		return fmt.Errorf("listing revisions: %w", err)
+	}
+	if len(revisions) == 0 {
+		fmt.Println("No earlier versions of this post")
+		return nil
+	}
+	// A URL can match posts in several feeds; each gets its own header.
+	for i, revision := range revisions {
+		if i == 0 || revision.PostID != revisions[i-1].PostID {
+			fmt.Printf("%s (%s)\n", sanitizeForLog(revision.CurrentTitle), sanitizeForLog(revision.FeedName))
+			fmt.Printf("ID: %s\n\n", revision.PostID)
+		}
+		fmt.Printf("Replaced %v\n", revision.CreatedAt)
+		fmt.Println(revision.Title)
+		fmt.Println(revision.Description)
+		fmt.Println(revision.PublishedAt.Time)
+		fmt.Println()
+	}
+	return nil
 }
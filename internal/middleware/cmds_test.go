@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	sqlc "github.com/diamondoughnut/gator/internal/database"
+)
+
+// emptyDB is a database/sql driver whose queries all return no rows, for
+// exercising the not-found paths without a Postgres server.
+type emptyDB struct{}
+
+func (emptyDB) Connect(context.Context) (driver.Conn, error) { return emptyDB{}, nil }
+func (emptyDB) Driver() driver.Driver                        { return nil }
+func (emptyDB) Prepare(string) (driver.Stmt, error)          { return emptyDB{}, nil }
+func (emptyDB) Begin() (driver.Tx, error)                    { return nil, errors.New("transactions not supported") }
+func (emptyDB) Close() error                                 { return nil }
+func (emptyDB) NumInput() int                                { return -1 }
+func (emptyDB) Exec([]driver.Value) (driver.Result, error)   { return driver.RowsAffected(0), nil }
+func (emptyDB) Query([]driver.Value) (driver.Rows, error)    { return emptyDB{}, nil }
+func (emptyDB) Columns() []string                            { return nil }
+func (emptyDB) Next([]driver.Value) error                    { return io.EOF }
+
+func TestResolveFeedNotFound(t *testing.T) {
+	db := sql.OpenDB(emptyDB{})
+	defer db.Close()
+	s := &State{Db: sqlc.New(db), Ctx: context.Background()}
+	for _, ref := range []string{
+		"typo",
+		"https://example.com/missing.xml",
+		"3b0c8f9e-1d2a-4e6f-9a7b-5c4d3e2f1a0b",
+	} {
+		feed, err := resolveFeed(s, ref)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("resolveFeed(%q) = %+v, %v, want ErrNotFound", ref, feed, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sqlc "github.com/diamondoughnut/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+// browseCursor is the sort position of the last post on a page of browse
+// output. It is handed to the user as an opaque token and passed back with
+// --cursor to fetch the page after it.
+type browseCursor struct {
+	Sort     string    `json:"s"`
+	Time     time.Time `json:"t"`
+	ID       uuid.UUID `json:"i"`
+	FeedName string    `json:"n,omitempty"`
+	FeedID   uuid.UUID `json:"f"`
+}
+
+func newBrowseCursor(sort string, post sqlc.GetPostsForUserRow) browseCursor {
+	return browseCursor{Sort: sort, Time: post.SortTime, ID: post.ID, FeedName: post.FeedName, FeedID: post.FeedID}
+}
+
+func (c browseCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseBrowseCursor(token string) (browseCursor, error) {
+	var c browseCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || c.ID == uuid.Nil {
+		return browseCursor{}, fmt.Errorf("cursor is not one printed by browse")
+	}
+	return c, nil
+}
+
+// apply sets the params that make GetPostsForUser start after c.
+func (c browseCursor) apply(params *sqlc.GetPostsForUserParams) {
+	params.AfterID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	params.AfterTime = sql.NullTime{Time: c.Time, Valid: true}
+	params.AfterFeedName = sql.NullString{String: c.FeedName, Valid: true}
+	params.AfterFeedID = uuid.NullUUID{UUID: c.FeedID, Valid: true}
+}
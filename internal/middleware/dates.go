@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pubDateZones maps the zone names seen in feed dates to their offsets.
+// time.Parse accepts any abbreviation but treats unknown ones as UTC, so
+// names are swapped for numeric offsets before parsing. Ambiguous names
+// such as IST are left out on purpose.
+var pubDateZones = map[string]string{
+	"UT":   "+0000",
+	"UTC":  "+0000",
+	"GMT":  "+0000",
+	"Z":    "+0000",
+	"EST":  "-0500",
+	"EDT":  "-0400",
+	"CST":  "-0600",
+	"CDT":  "-0500",
+	"MST":  "-0700",
+	"MDT":  "-0600",
+	"PST":  "-0800",
+	"PDT":  "-0700",
+	"AKST": "-0900",
+	"AKDT": "-0800",
+	"HST":  "-1000",
+	"WET":  "+0000",
+	"WEST": "+0100",
+	"BST":  "+0100",
+	"CET":  "+0100",
+	"CEST": "+0200",
+	"MET":  "+0100",
+	"MEST": "+0200",
+	"EET":  "+0200",
+	"EEST": "+0300",
+	"MSK":  "+0300",
+	"JST":  "+0900",
+	"KST":  "+0900",
+	"AEST": "+1000",
+	"AEDT": "+1100",
+	"ACST": "+0930",
+	"ACDT": "+1030",
+	"AWST": "+0800",
+	"NZST": "+1200",
+	"NZDT": "+1300",
+}
+
+var weekdayNames = map[string]bool{
+	"mon": true, "tue": true, "tues": true, "wed": true, "thu": true, "thur": true, "thurs": true,
+	"fri": true, "sat": true, "sun": true,
+	"monday": true, "tuesday": true, "wednesday": true, "thursday": true,
+	"friday": true, "saturday": true, "sunday": true,
+}
+
+// isoLayouts covers RFC 3339 and the ISO 8601 variants feeds actually use.
+// Fractional seconds are accepted by time.Parse without being in the layout.
+var isoLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"20060102T150405Z0700",
+	"2006-01-02",
+	"01/02/2006",
+}
+
+// rfc822Layouts is every combination of the RFC 822/1123 pieces publishers
+// mix up: one or two digit days, short or long months, two or four digit
+// years, optional seconds and optional or colon-separated offsets. Weekdays
+// and commas are stripped before these are tried.
+var rfc822Layouts = buildRFC822Layouts()
+
+func buildRFC822Layouts() []string {
+	var layouts []string
+	for _, month := range []string{"Jan", "January"} {
+		for _, year := range []string{"2006", "06"} {
+			for _, clock := range []string{"15:04:05", "15:04"} {
+				for _, zone := range []string{" -0700", " -07:00", ""} {
+					layouts = append(layouts,
+						"2 "+month+" "+year+" "+clock+zone,
+						month+" 2 "+year+" "+clock+zone,
+					)
+				}
+			}
+			layouts = append(layouts, "2 "+month+" "+year, month+" 2 "+year)
+		}
+	}
+	return append(layouts,
+		"Jan 2 15:04:05 2006",
+		"Jan 2 15:04:05 -0700 2006",
+	)
+}
+
+// parsePubDate parses the date formats found in RSS, Atom and JSON feeds.
+// The result is in UTC; ok is false when value matches none of them.
+func parsePubDate(value string) (t time.Time, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range isoLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	value = normalizeRFC822(value)
+	for _, layout := range rfc822Layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// normalizeRFC822 drops the weekday, commas and trailing comments such as
+// "(UTC)", splits dashed dates and replaces zone names with offsets.
+func normalizeRFC822(value string) string {
+	if i := strings.Index(value, "("); i > 0 {
+		value = value[:i]
+	}
+	value = strings.ReplaceAll(value, ",", " ")
+	fields := strings.Fields(value)
+	if len(fields) > 0 && weekdayNames[strings.ToLower(strings.TrimSuffix(fields[0], "."))] {
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && strings.Count(fields[0], "-") == 2 {
+		fields = append(strings.Split(fields[0], "-"), fields[1:]...)
+	}
+	for i, field := range fields {
+		upper := strings.ToUpper(field)
+		if offset, ok := pubDateZones[upper]; ok {
+			fields[i] = offset
+			continue
+		}
+		if upper == "SEPT" {
+			fields[i] = "Sep"
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// parseCutoff reads a point in time given either as an age before now
+// ("90m", "36h", "7d", "2w") or as a date parsePubDate understands.
+func parseCutoff(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if age, err := time.ParseDuration(value); err == nil {
+		if age < 0 {
+			return time.Time{}, fmt.Errorf("age %q is negative", value)
+		}
+		return now.Add(-age).UTC(), nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		count, ok := strings.CutSuffix(value, suffix)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(count); err == nil && n >= 0 {
+			return now.Add(-time.Duration(n) * unit).UTC(), nil
+		}
+	}
+	if t, ok := parsePubDate(value); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither an age like 7d or 36h nor a date", value)
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePubDate(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	}
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		// RFC 822 / RFC 1123 as used by RSS 2.0.
+		{"RFC1123Z", "Tue, 02 Sep 2025 04:30:00 +0000", utc(2025, time.September, 2, 4, 30, 0)},
+		{"RFC1123 GMT", "Tue, 02 Sep 2025 04:30:00 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"RFC1123 UT", "Tue, 02 Sep 2025 04:30:00 UT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"RFC1123 UTC", "Tue, 02 Sep 2025 04:30:00 UTC", utc(2025, time.September, 2, 4, 30, 0)},
+		{"negative offset", "Mon, 01 Sep 2025 22:15:00 -0700", utc(2025, time.September, 2, 5, 15, 0)},
+		{"positive offset", "Wed, 03 Sep 2025 10:00:00 +0530", utc(2025, time.September, 3, 4, 30, 0)},
+		{"colon offset", "Wed, 03 Sep 2025 10:00:00 +05:30", utc(2025, time.September, 3, 4, 30, 0)},
+		{"EST", "Tue, 02 Sep 2025 04:30:00 EST", utc(2025, time.September, 2, 9, 30, 0)},
+		{"EDT", "Tue, 02 Sep 2025 04:30:00 EDT", utc(2025, time.September, 2, 8, 30, 0)},
+		{"PST", "Fri, 10 Jan 2025 16:00:00 PST", utc(2025, time.January, 11, 0, 0, 0)},
+		{"PDT", "Thu, 10 Jul 2025 16:00:00 PDT", utc(2025, time.July, 10, 23, 0, 0)},
+		{"CET", "Thu, 10 Jul 2025 16:00:00 CET", utc(2025, time.July, 10, 15, 0, 0)},
+		{"military Z", "Thu, 10 Jul 2025 16:00:00 Z", utc(2025, time.July, 10, 16, 0, 0)},
+		{"lowercase zone", "Thu, 10 Jul 2025 16:00:00 gmt", utc(2025, time.July, 10, 16, 0, 0)},
+		{"single digit day", "Tue, 2 Sep 2025 04:30:00 +0000", utc(2025, time.September, 2, 4, 30, 0)},
+		{"no seconds", "Tue, 02 Sep 2025 04:30 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"no weekday", "02 Sep 2025 04:30:00 +0000", utc(2025, time.September, 2, 4, 30, 0)},
+		{"full weekday", "Tuesday, 02 Sep 2025 04:30:00 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"wrong weekday", "Fri, 02 Sep 2025 04:30:00 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"full month", "Tue, 02 September 2025 04:30:00 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"Sept", "Tue, 02 Sept 2025 04:30:00 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"two digit year", "Tue, 02 Sep 25 04:30:00 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"no zone", "Tue, 02 Sep 2025 04:30:00", utc(2025, time.September, 2, 4, 30, 0)},
+		{"comment after offset", "Tue, 02 Sep 2025 04:30:00 +0000 (UTC)", utc(2025, time.September, 2, 4, 30, 0)},
+		{"extra whitespace", "  Tue,  02 Sep 2025   04:30:00 GMT \n", utc(2025, time.September, 2, 4, 30, 0)},
+		{"missing comma", "Tue 02 Sep 2025 04:30:00 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"date only", "02 Sep 2025", utc(2025, time.September, 2, 0, 0, 0)},
+		{"dashed date", "02-Sep-2025 04:30:00 GMT", utc(2025, time.September, 2, 4, 30, 0)},
+		{"dashed short date", "02-Jan-06", utc(2006, time.January, 2, 0, 0, 0)},
+		{"US order", "September 2, 2025 04:30:00 -0400", utc(2025, time.September, 2, 8, 30, 0)},
+		{"US order date only", "Sep 2, 2025", utc(2025, time.September, 2, 0, 0, 0)},
+		{"ANSIC", "Tue Sep  2 04:30:00 2025", utc(2025, time.September, 2, 4, 30, 0)},
+		{"UnixDate", "Tue Sep  2 04:30:00 EDT 2025", utc(2025, time.September, 2, 8, 30, 0)},
+
+		// RFC 3339 / ISO 8601 as used by Atom, JSON Feed and dc:date.
+		{"RFC3339 Z", "2025-09-02T04:30:00Z", utc(2025, time.September, 2, 4, 30, 0)},
+		{"RFC3339 offset", "2025-09-02T06:30:00+02:00", utc(2025, time.September, 2, 4, 30, 0)},
+		{"RFC3339 fraction", "2025-09-02T04:30:00.123456Z", time.Date(2025, time.September, 2, 4, 30, 0, 123456000, time.UTC)},
+		{"ISO basic offset", "2025-09-02T06:30:00+0200", utc(2025, time.September, 2, 4, 30, 0)},
+		{"ISO no zone", "2025-09-02T04:30:00", utc(2025, time.September, 2, 4, 30, 0)},
+		{"ISO no seconds", "2025-09-02T04:30Z", utc(2025, time.September, 2, 4, 30, 0)},
+		{"ISO space", "2025-09-02 04:30:00", utc(2025, time.September, 2, 4, 30, 0)},
+		{"ISO space offset", "2025-09-02 00:30:00 -0400", utc(2025, time.September, 2, 4, 30, 0)},
+		{"ISO compact", "20250902T043000Z", utc(2025, time.September, 2, 4, 30, 0)},
+		{"ISO date", "2025-09-02", utc(2025, time.September, 2, 0, 0, 0)},
+		{"US slashes", "09/02/2025", utc(2025, time.September, 2, 0, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePubDate(tt.value)
+			if !ok {
+				t.Fatalf("parsePubDate(%q) failed", tt.value)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parsePubDate(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+			if got.Location() != time.UTC {
+				t.Errorf("parsePubDate(%q) location = %v, want UTC", tt.value, got.Location())
+			}
+		})
+	}
+}
+
+func TestParsePubDateRejects(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"   ",
+		"yesterday",
+		"not a date at all",
+		"Tue, 32 Sep 2025 04:30:00 GMT",
+		"2025-13-02T04:30:00Z",
+		"Tue, 02 Foo 2025 04:30:00 GMT",
+	} {
+		if got, ok := parsePubDate(value); ok {
+			t.Errorf("parsePubDate(%q) = %v, want failure", value, got)
+		}
+	}
+}
+
+func TestParseCutoff(t *testing.T) {
+	now := time.Date(2025, time.September, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"36h", now.Add(-36 * time.Hour)},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"7d", now.AddDate(0, 0, -7)},
+		{"2w", now.AddDate(0, 0, -14)},
+		{"0d", now},
+		{"2025-09-01", time.Date(2025, time.September, 1, 0, 0, 0, 0, time.UTC)},
+		{"2025-09-01T08:00:00+02:00", time.Date(2025, time.September, 1, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseCutoff(tt.value, now)
+		if err != nil {
+			t.Errorf("parseCutoff(%q) error: %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseCutoff(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+	for _, value := range []string{"", "-5h", "-3d", "soon", "7x"} {
+		if got, err := parseCutoff(value, now); err == nil {
+			t.Errorf("parseCutoff(%q) = %v, want error", value, got)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	sqlc "github.com/diamondoughnut/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+// Media holds the Media RSS elements of an item. Contents may also be
+// wrapped in <media:group> when a publisher offers several renditions.
+type Media struct {
+	MediaContents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaGroups     []MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+	MediaThumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type MediaGroup struct {
+	Contents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type MediaContent struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Medium   string `xml:"medium,attr"`
+	FileSize string `xml:"fileSize,attr"`
+	Duration string `xml:"duration,attr"`
+}
+
+type MediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+// ITunes holds the podcast fields Apple's namespace adds to an item.
+type ITunes struct {
+	ITunesDuration string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesImage    ITunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// collectEnclosures merges <enclosure>, Media RSS and iTunes attachments
+// into one list with a single entry per URL. Details missing from one
+// source are taken from another that mentions the same URL.
+func collectEnclosures(item RSSItem) []RSSEnclosure {
+	var all []RSSEnclosure
+	for _, enclosure := range item.Enclosures {
+		if enclosure.Duration == 0 {
+			enclosure.Duration = parseDuration(item.ITunesDuration)
+		}
+		all = append(all, enclosure)
+	}
+	contents := item.MediaContents
+	thumbnails := item.MediaThumbnails
+	for _, group := range item.MediaGroups {
+		contents = append(contents, group.Contents...)
+		thumbnails = append(thumbnails, group.Thumbnails...)
+	}
+	for _, content := range contents {
+		all = append(all, RSSEnclosure{
+			URL:      content.URL,
+			Length:   content.FileSize,
+			Type:     content.Type,
+			Medium:   content.Medium,
+			Duration: parseDuration(content.Duration),
+		})
+	}
+	for _, thumbnail := range thumbnails {
+		all = append(all, RSSEnclosure{URL: thumbnail.URL, Medium: "image"})
+	}
+	if item.ITunesImage.Href != "" {
+		all = append(all, RSSEnclosure{URL: item.ITunesImage.Href, Medium: "image"})
+	}
+
+	merged := make([]RSSEnclosure, 0, len(all))
+	index := make(map[string]int)
+	for _, enclosure := range all {
+		enclosure.URL = strings.TrimSpace(enclosure.URL)
+		if enclosure.URL == "" {
+			continue
+		}
+		enclosure.Type = strings.TrimSpace(enclosure.Type)
+		if enclosure.Type == "" {
+			enclosure.Type = mimeTypeFromURL(enclosure.URL)
+		}
+		enclosure.Medium = enclosureMedium(enclosure.Medium, enclosure.Type)
+		i, ok := index[enclosure.URL]
+		if !ok {
+			index[enclosure.URL] = len(merged)
+			merged = append(merged, enclosure)
+			continue
+		}
+		existing := &merged[i]
+		if existing.Type == "" {
+			existing.Type = enclosure.Type
+		}
+		if existing.Medium == "" {
+			existing.Medium = enclosure.Medium
+		}
+		if enclosureLength(existing.Length) == 0 {
+			existing.Length = enclosure.Length
+		}
+		if existing.Duration == 0 {
+			existing.Duration = enclosure.Duration
+		}
+	}
+	return merged
+}
+
+// enclosureMedium returns audio, video or image, preferring the publisher's
+// Media RSS medium and falling back to the MIME type.
+func enclosureMedium(medium, mimeType string) string {
+	switch medium = strings.ToLower(strings.TrimSpace(medium)); medium {
+	case "audio", "video", "image":
+		return medium
+	}
+	kind, _, _ := strings.Cut(strings.ToLower(mimeType), "/")
+	switch kind {
+	case "audio", "video", "image":
+		return kind
+	}
+	return ""
+}
+
+func mimeTypeFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	mimeType, _, _ := strings.Cut(mime.TypeByExtension(path.Ext(u.Path)), ";")
+	return mimeType
+}
+
+// enclosureLength reads a byte count, treating anything unusable as unknown.
+func enclosureLength(value string) int64 {
+	length, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || length < 0 {
+		return 0
+	}
+	return length
+}
+
+// parseDuration reads durations written as seconds ("3723" or "3723.5") or
+// as clock time ("1:02:03" or "62:03") and returns whole seconds, or 0 if
+// value is empty or malformed.
+func parseDuration(value string) int32 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	var total float64
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0
+		}
+		total = total*60 + n
+	}
+	if total > 1<<31-1 {
+		return 0
+	}
+	return int32(total)
+}
+
+// itemAttachmentsHash fingerprints an item's categories and enclosures,
+// which live in their own tables and are only rewritten when it changes.
+func itemAttachmentsHash(item RSSItem) string {
+	h := sha256.New()
+	for _, category := range item.Categories {
+		fmt.Fprintf(h, "category\x00%s\x00", category)
+	}
+	for _, e := range item.Enclosures {
+		fmt.Fprintf(h, "enclosure\x00%s\x00%s\x00%s\x00%s\x00%d\x00", e.URL, e.Type, e.Medium, e.Length, e.Duration)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// enclosureParams lays enclosures out as the parallel arrays
+// SetPostEnclosures takes. The arrays are never nil, so storing an item
+// without enclosures clears any the post had.
+func enclosureParams(postID uuid.UUID, enclosures []RSSEnclosure) sqlc.SetPostEnclosuresParams {
+	params := sqlc.SetPostEnclosuresParams{
+		PostID:    postID,
+		Urls:      make([]string, 0, len(enclosures)),
+		MimeTypes: make([]string, 0, len(enclosures)),
+		Media:     make([]string, 0, len(enclosures)),
+		Lengths:   make([]int64, 0, len(enclosures)),
+		Durations: make([]int32, 0, len(enclosures)),
+	}
+	for _, enclosure := range enclosures {
+		params.Urls = append(params.Urls, enclosure.URL)
+		params.MimeTypes = append(params.MimeTypes, enclosure.Type)
+		params.Media = append(params.Media, enclosure.Medium)
+		params.Lengths = append(params.Lengths, enclosureLength(enclosure.Length))
+		params.Durations = append(params.Durations, enclosure.Duration)
+	}
+	return params
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import "testing"
+
+const podcastFixture = `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0"
+     xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"
+     xmlns:media="http://search.yahoo.com/mrss/">
+  <channel>
+    <title>Example Podcast</title>
+    <item>
+      <title>Ep 12: Real Title</title>
+      <itunes:title>Real Title</itunes:title>
+      <itunes:episode>12</itunes:episode>
+      <author>host@example.com (Host)</author>
+      <itunes:author>Example Network</itunes:author>
+      <guid>ep-12</guid>
+      <enclosure url="https://cdn.example.com/ep12.mp3" length="5000000" type="audio/mpeg"/>
+      <itunes:duration>1:02:03</itunes:duration>
+      <itunes:image href="https://cdn.example.com/ep12.jpg"/>
+      <media:content url="https://cdn.example.com/ep12.mp3" medium="audio" duration="3723"/>
+      <media:group>
+        <media:content url="https://cdn.example.com/ep12.mp4" type="video/mp4" fileSize="9000000"/>
+        <media:thumbnail url="https://cdn.example.com/ep12.jpg"/>
+      </media:group>
+    </item>
+  </channel>
+</rss>`
+
+func TestParseFeedPodcastItem(t *testing.T) {
+	feed, err := parseFeed([]byte(podcastFixture), "application/rss+xml")
+	if err != nil {
+		t.Fatalf("parseFeed error: %v", err)
+	}
+	if len(feed.Channel.Item) != 1 {
+		t.Fatalf("got %d items, want 1", len(feed.Channel.Item))
+	}
+	item := feed.Channel.Item[0]
+	if item.Title != "Ep 12: Real Title" {
+		t.Errorf("Title = %q, want the RSS title", item.Title)
+	}
+	if item.Author != "host@example.com (Host)" {
+		t.Errorf("Author = %q, want the RSS author", item.Author)
+	}
+
+	want := []RSSEnclosure{
+		{URL: "https://cdn.example.com/ep12.mp3", Length: "5000000", Type: "audio/mpeg", Medium: "audio", Duration: 3723},
+		{URL: "https://cdn.example.com/ep12.mp4", Length: "9000000", Type: "video/mp4", Medium: "video"},
+		{URL: "https://cdn.example.com/ep12.jpg", Type: "image/jpeg", Medium: "image"},
+	}
+	if len(item.Enclosures) != len(want) {
+		t.Fatalf("Enclosures = %+v, want %+v", item.Enclosures, want)
+	}
+	for i := range want {
+		if item.Enclosures[i] != want[i] {
+			t.Errorf("Enclosures[%d] = %+v, want %+v", i, item.Enclosures[i], want[i])
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int32
+	}{
+		{"3723", 3723},
+		{"3723.5", 3723},
+		{"1:02:03", 3723},
+		{"62:03", 3723},
+		{" 45 ", 45},
+		{"", 0},
+		{"1:2:3:4", 0},
+		{"-5", 0},
+		{"abc", 0},
+		{"NaN", 0},
+		{"99999999999", 0},
+	}
+	for _, tt := range tests {
+		if got := parseDuration(tt.value); got != tt.want {
+			t.Errorf("parseDuration(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Handlers wrap these sentinels so that main can pick an exit code and a
+// friendly message with errors.Is.
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrAlreadyExists   = errors.New("already exists")
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrNotLoggedIn     = errors.New("not logged in")
+	ErrNetwork         = errors.New("network error")
+	ErrParse           = errors.New("parse error")
+	ErrFeedsFailed     = errors.New("some feeds failed")
+	ErrInterrupted     = errors.New("interrupted")
+)
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
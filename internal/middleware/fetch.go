@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/diamondoughnut/gator/internal/config"
+)
+
+const (
+	maxRedirects = 10
+	// DefaultMaxFeedBytes caps a decoded feed body when the config does not
+	// set max_feed_bytes.
+	DefaultMaxFeedBytes = 10 << 20
+	acceptHeader        = "application/rss+xml, application/atom+xml, application/feed+json, application/rdf+xml, application/xml;q=0.9, text/xml;q=0.9, application/json;q=0.8, */*;q=0.5"
+)
+
+var errBlockedAddress = errors.New("address is private or reserved")
+
+// blockedPrefixes are ranges not already covered by the netip.Addr helpers
+// used in isBlockedAddr.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+func isBlockedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetcher downloads feeds through a client that refuses to connect to
+// loopback, link-local, private, CGNAT and other reserved addresses unless
+// they are on the configured allowlist.
+type Fetcher struct {
+	Client       *http.Client
+	MaxBodySize  int64
+	allowedHosts map[string]bool
+	allowedNets  []netip.Prefix
+}
+
+// NewFetcher builds a Fetcher from the config. Allowlist entries may be
+// hostnames, IP addresses or CIDR ranges.
+func NewFetcher(cfg *config.Config) (*Fetcher, error) {
+	f := &Fetcher{MaxBodySize: cfg.MaxFeedBytes, allowedHosts: make(map[string]bool)}
+	if f.MaxBodySize <= 0 {
+		f.MaxBodySize = DefaultMaxFeedBytes
+	}
+	for _, entry := range cfg.FetchAllowlist {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			f.allowedNets = append(f.allowedNets, prefix.Masked())
+			continue
+		}
+		if ip, err := netip.ParseAddr(entry); err == nil {
+			f.allowedNets = append(f.allowedNets, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		if entry == "" || strings.ContainsAny(entry, "/:") {
+			return nil, fmt.Errorf("%w: invalid fetch_allowlist entry %q", ErrInvalidArgument, entry)
+		}
+		f.allowedHosts[strings.ToLower(entry)] = true
+	}
+
+	guarded := &net.Dialer{Timeout: 10 * time.Second, Control: f.checkConn}
+	unguarded := &net.Dialer{Timeout: 10 * time.Second}
+	transport := &http.Transport{
+		// Never go through an environment proxy: the guard has to see the
+		// address we actually connect to.
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err == nil && f.allowedHosts[strings.ToLower(host)] {
+				return unguarded.DialContext(ctx, network, addr)
+			}
+			return guarded.DialContext(ctx, network, addr)
+		},
+		// Accept-Encoding is set by hand so brotli can be offered too, which
+		// means the transport leaves decoding to readBody.
+		DisableCompression:    true,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 20 * time.Second,
+		MaxIdleConnsPerHost:   2,
+	}
+	f.Client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return f.validateURL(req.URL.String())
+		},
+	}
+	return f, nil
+}
+
+func (f *Fetcher) allowedAddr(ip netip.Addr) bool {
+	for _, prefix := range f.allowedNets {
+		if prefix.Contains(ip.Unmap()) {
+			return true
+		}
+	}
+	return !isBlockedAddr(ip)
+}
+
+// checkConn runs after DNS resolution, right before connecting, so it also
+// catches public hostnames that resolve to internal addresses.
+func (f *Fetcher) checkConn(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !f.allowedAddr(ip) {
+		return fmt.Errorf("%w: %s", errBlockedAddress, ip)
+	}
+	return nil
+}
+
+func (f *Fetcher) validateURL(feedURL string) error {
+	parsedURL, err := url.Parse(feedURL)
+	if err != nil {
+		return fmt.Errorf("%w: invalid URL: %v", ErrInvalidArgument, err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("%w: only HTTP and HTTPS URLs are allowed", ErrInvalidArgument)
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: URL has no host", ErrInvalidArgument)
+	}
+	if f.allowedHosts[host] {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: localhost URLs are not allowed", ErrInvalidArgument)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !f.allowedAddr(ip) {
+		return fmt.Errorf("%w: %s is a private or reserved address", ErrInvalidArgument, ip)
+	}
+	return nil
+}
+
+// FetchResult carries the parsed feed along with the caching headers the
+// publisher returned. Feed is nil when the server answered 304 Not Modified.
+// MovedTo is set when the feed was reached only through permanent redirects.
+type FetchResult struct {
+	Feed         *RSSFeed
+	NotModified  bool
+	ETag         string
+	LastModified string
+	MovedTo      string
+}
+
+func (f *Fetcher) FetchFeed(ctx context.Context, feedURL, etag, lastModified string) (FetchResult, error) {
+	if err := f.validateURL(feedURL); err != nil {
+		return FetchResult{}, err
+	}
+	// amazonq-ignore-next-line
+	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("Accept-Encoding", "gzip, br, deflate")
+	res, err := f.Client.Do(req)
+	if err != nil {
+		return FetchResult{}, fmt.Errorf("%w: %v", ErrNetwork, sanitizeForLog(err.Error()))
+	}
+	defer res.Body.Close()
+	movedTo := permanentRedirectTarget(res)
+	if res.StatusCode == http.StatusNotModified {
+		return FetchResult{NotModified: true, ETag: etag, LastModified: lastModified, MovedTo: movedTo}, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return FetchResult{}, &HTTPStatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+	contentType := res.Header.Get("Content-Type")
+	data, err := f.readBody(res)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	if err := checkContentType(contentType, data); err != nil {
+		return FetchResult{}, err
+	}
+	feed, err := parseFeed(data, contentType)
+	if err != nil {
+		return FetchResult{}, fmt.Errorf("%w: %v", ErrParse, sanitizeForLog(err.Error()))
+	}
+	return FetchResult{Feed: feed, ETag: res.Header.Get("ETag"), LastModified: res.Header.Get("Last-Modified"), MovedTo: movedTo}, nil
+}
+
+// HTTPStatusError is returned for any non-2xx, non-304 response. It unwraps
+// to ErrNotFound for 404 and 410 so callers can tell a missing feed from a
+// server that is temporarily failing.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %s", sanitizeForLog(e.Status))
+}
+
+func (e *HTTPStatusError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone {
+		return ErrNotFound
+	}
+	return ErrNetwork
+}
+
+// readBody decodes the response according to its Content-Encoding and reads
+// at most MaxBodySize bytes of the decoded stream, so a small compressed
+// body cannot expand into an unbounded one.
+func (f *Fetcher) readBody(res *http.Response) ([]byte, error) {
+	if res.ContentLength > f.MaxBodySize {
+		return nil, fmt.Errorf("%w: feed is %d bytes, limit is %d", ErrNetwork, res.ContentLength, f.MaxBodySize)
+	}
+	var body io.Reader = res.Body
+	switch encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad gzip body: %v", ErrParse, err)
+		}
+		defer gz.Close()
+		body = gz
+	case "br":
+		body = brotli.NewReader(res.Body)
+	case "deflate":
+		zr, err := zlib.NewReader(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad deflate body: %v", ErrParse, err)
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("%w: unsupported content encoding %q", ErrParse, sanitizeForLog(encoding))
+	}
+	data, err := io.ReadAll(io.LimitReader(body, f.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading body: %v", ErrNetwork, err)
+	}
+	if int64(len(data)) > f.MaxBodySize {
+		return nil, fmt.Errorf("%w: feed exceeds %d bytes", ErrNetwork, f.MaxBodySize)
+	}
+	return data, nil
+}
+
+// checkContentType rejects responses that are clearly not feeds, such as
+// HTML error pages and images. Servers that label a real feed as text/html
+// are tolerated when the body starts like an XML document.
+func checkContentType(contentType string, data []byte) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	switch {
+	case strings.Contains(mediaType, "xml"), strings.Contains(mediaType, "rss"),
+		strings.Contains(mediaType, "atom"), strings.Contains(mediaType, "json"),
+		mediaType == "text/plain", mediaType == "application/octet-stream":
+		return nil
+	case mediaType == "text/html" && bytes.HasPrefix(bytes.TrimSpace(data), []byte("<?xml")):
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported content type %q", ErrParse, sanitizeForLog(mediaType))
+}
@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/diamondoughnut/gator/internal/config"
+)
+
+func TestIsBlockedAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"127.8.9.10", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.254", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		{"fd00::1", true},
+		{"fc12:3456::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"224.0.0.1", true},
+		{"198.18.0.1", true},
+		{"240.0.0.1", true},
+		{"64:ff9b::a00:1", true},
+		{"8.8.8.8", false},
+		{"172.32.0.1", false},
+		{"100.128.0.1", false},
+		{"2606:4700::1111", false},
+		{"::ffff:8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		if got := isBlockedAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isBlockedAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestNewFetcherAllowlist(t *testing.T) {
+	f, err := NewFetcher(&config.Config{FetchAllowlist: []string{" 10.0.0.0/8 ", "192.168.1.5", "::ffff:172.16.0.9", "Feeds.Internal"}})
+	if err != nil {
+		t.Fatalf("NewFetcher error: %v", err)
+	}
+	if f.MaxBodySize != DefaultMaxFeedBytes {
+		t.Errorf("MaxBodySize = %d, want %d", f.MaxBodySize, DefaultMaxFeedBytes)
+	}
+	if !f.allowedHosts["feeds.internal"] {
+		t.Errorf("allowedHosts = %v, want feeds.internal", f.allowedHosts)
+	}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.20.30.40", true},
+		{"::ffff:10.20.30.40", true},
+		{"192.168.1.5", true},
+		{"192.168.1.6", false},
+		{"172.16.0.9", true},
+		{"127.0.0.1", false},
+		{"8.8.8.8", true},
+	}
+	for _, tt := range tests {
+		if got := f.allowedAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("allowedAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestNewFetcherRejectsAllowlist(t *testing.T) {
+	for _, entry := range []string{"", "   ", "10.0.0.0/33", "feeds.internal:8080", "http://feeds.internal", "fe80::1::2"} {
+		_, err := NewFetcher(&config.Config{FetchAllowlist: []string{entry}})
+		if !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("NewFetcher(%q) error = %v, want ErrInvalidArgument", entry, err)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	f, err := NewFetcher(&config.Config{FetchAllowlist: []string{"10.1.0.0/16", "feeds.internal", "localhost"}})
+	if err != nil {
+		t.Fatalf("NewFetcher error: %v", err)
+	}
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/feed.xml", true},
+		{"http://93.184.216.34/rss", true},
+		{"http://feeds.internal/rss", true},
+		{"http://FEEDS.internal:8080/rss", true},
+		{"http://localhost:8080/rss", true},
+		{"http://10.1.2.3/rss", true},
+		{"http://10.2.0.1/rss", false},
+		{"http://127.0.0.1/rss", false},
+		{"http://[::1]/rss", false},
+		{"http://192.168.0.1/rss", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://100.64.1.1/rss", false},
+		{"http://[fd00::1]/rss", false},
+		{"http://[::ffff:127.0.0.1]/rss", false},
+		{"http://app.localhost/rss", false},
+		{"ftp://example.com/feed.xml", false},
+		{"file:///etc/passwd", false},
+		{"http:///rss", false},
+		{"http://exa mple.com/", false},
+	}
+	for _, tt := range tests {
+		err := f.validateURL(tt.url)
+		if tt.allowed && err != nil {
+			t.Errorf("validateURL(%q) error: %v", tt.url, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("validateURL(%q) error = %v, want ErrInvalidArgument", tt.url, err)
+		}
+	}
+}
+
+func TestCheckConn(t *testing.T) {
+	f, err := NewFetcher(&config.Config{FetchAllowlist: []string{"172.20.0.0/16"}})
+	if err != nil {
+		t.Fatalf("NewFetcher error: %v", err)
+	}
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:4700::1111]:443", false},
+		{"172.20.5.5:80", false},
+		{"172.21.5.5:80", true},
+		{"127.0.0.1:80", true},
+		{"169.254.169.254:80", true},
+		{"100.100.100.200:80", true},
+		{"[fd12::1]:80", true},
+		{"[::ffff:192.168.0.1]:80", true},
+	}
+	for _, tt := range tests {
+		err := f.checkConn("tcp", tt.address, nil)
+		if tt.blocked && !errors.Is(err, errBlockedAddress) {
+			t.Errorf("checkConn(%q) error = %v, want errBlockedAddress", tt.address, err)
+		}
+		if !tt.blocked && err != nil {
+			t.Errorf("checkConn(%q) error: %v", tt.address, err)
+		}
+	}
+	if err := f.checkConn("tcp", "no-port", nil); err == nil {
+		t.Error("checkConn(\"no-port\") succeeded, want error")
+	}
+}
+
+func TestFetchFeedRefusesRedirectToBlockedAddress(t *testing.T) {
+	var reachedTarget bool
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			reachedTarget = true
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>internal</title></channel></rss>`))
+			return
+		}
+		// The test server listens on loopback and is reached through the
+		// allowlisted name "localhost"; redirecting to its IP must fail.
+		u, _ := url.Parse(server.URL)
+		http.Redirect(w, r, "http://127.0.0.1:"+u.Port()+"/internal", http.StatusFound)
+	}))
+	defer server.Close()
+
+	f, err := NewFetcher(&config.Config{FetchAllowlist: []string{"localhost"}})
+	if err != nil {
+		t.Fatalf("NewFetcher error: %v", err)
+	}
+	feedURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/feed"
+	_, err = f.FetchFeed(context.Background(), feedURL, "", "")
+	if err == nil {
+		t.Fatal("FetchFeed followed a redirect to a loopback address")
+	}
+	if !strings.Contains(err.Error(), "private or reserved") {
+		t.Errorf("FetchFeed error = %v, want a private or reserved address error", err)
+	}
+	if reachedTarget {
+		t.Error("redirect target was requested")
+	}
+}
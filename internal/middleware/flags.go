@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"flag"
+	"strings"
+)
+
+// parseFlags parses flags that may appear anywhere among the command's
+// arguments and returns the remaining positional arguments in order. A "--"
+// ends flag parsing: everything after it is positional, even if it starts
+// with a dash.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// parseQueryFlags is parseFlags for commands whose positional arguments are
+// a query that may itself contain dashes, such as "-async" to exclude a
+// word. Only arguments naming one of flags are parsed as flags; anything
+// else, including unknown "-word" arguments, is passed through in order.
+// A "--" still ends flag parsing.
+func parseQueryFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var flagArgs, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		f := flags.Lookup(name)
+		if !strings.HasPrefix(arg, "-") || f == nil {
+			positional = append(positional, arg)
+			continue
+		}
+		flagArgs = append(flagArgs, arg)
+		if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); hasValue || ok && boolFlag.IsBoolFlag() {
+			continue
+		}
+		if i+1 < len(args) {
+			i++
+			flagArgs = append(flagArgs, args[i])
+		}
+	}
+	if err := flags.Parse(flagArgs); err != nil {
+		return nil, err
+	}
+	return positional, nil
+}
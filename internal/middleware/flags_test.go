@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantArgs    []string
+		wantLimit   int
+		wantVerbose bool
+	}{
+		{"no arguments", nil, nil, 0, false},
+		{"positional only", []string{"a", "b"}, []string{"a", "b"}, 0, false},
+		{"flags first", []string{"--limit", "5", "-v", "a"}, []string{"a"}, 5, true},
+		{"flags last", []string{"a", "--limit=5", "-v"}, []string{"a"}, 5, true},
+		{"flags between", []string{"a", "--limit", "5", "b", "-v", "c"}, []string{"a", "b", "c"}, 5, true},
+		{"terminator first", []string{"--", "-v", "a", "--limit", "5"}, []string{"-v", "a", "--limit", "5"}, 0, false},
+		{"terminator later", []string{"a", "-v", "--", "-b", "c", "-d"}, []string{"a", "-b", "c", "-d"}, 0, true},
+		{"terminator after flag value", []string{"--limit", "5", "--", "-x"}, []string{"-x"}, 5, false},
+		{"second terminator is positional", []string{"--", "a", "--", "b"}, []string{"a", "--", "b"}, 0, false},
+		{"single dash is positional", []string{"-", "a"}, []string{"-", "a"}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			limit := flags.Int("limit", 0, "")
+			verbose := flags.Bool("v", false, "")
+			got, err := parseFlags(flags, tt.args)
+			if err != nil {
+				t.Fatalf("parseFlags(%q) error: %v", tt.args, err)
+			}
+			if !slices.Equal(got, tt.wantArgs) {
+				t.Errorf("parseFlags(%q) = %q, want %q", tt.args, got, tt.wantArgs)
+			}
+			if *limit != tt.wantLimit || *verbose != tt.wantVerbose {
+				t.Errorf("parseFlags(%q) set limit=%d v=%v, want limit=%d v=%v", tt.args, *limit, *verbose, tt.wantLimit, tt.wantVerbose)
+			}
+		})
+	}
+}
+
+func TestParseFlagsRejects(t *testing.T) {
+	for _, args := range [][]string{
+		{"-x"},
+		{"a", "--unknown"},
+		{"a", "--limit", "five"},
+		{"--limit"},
+	} {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.Int("limit", 0, "")
+		if got, err := parseFlags(flags, args); err == nil {
+			t.Errorf("parseFlags(%q) = %q, want error", args, got)
+		}
+	}
+}
+
+func TestParseQueryFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantArgs    []string
+		wantLimit   int
+		wantVerbose bool
+	}{
+		{"exclusion", []string{"rust", "-async"}, []string{"rust", "-async"}, 0, false},
+		{"exclusion first", []string{"-async", "rust"}, []string{"-async", "rust"}, 0, false},
+		{"double dash word", []string{"rust", "--async"}, []string{"rust", "--async"}, 0, false},
+		{"flags around query", []string{"-v", "rust", "-async", "--limit", "5"}, []string{"rust", "-async"}, 5, true},
+		{"flag with equals", []string{"rust", "--limit=5", "-async"}, []string{"rust", "-async"}, 5, false},
+		{"single dash flag", []string{"-limit", "5", "rust"}, []string{"rust"}, 5, false},
+		{"terminator", []string{"--limit", "5", "--", "-v", "--limit"}, []string{"-v", "--limit"}, 5, false},
+		{"single dash", []string{"a", "-", "b"}, []string{"a", "-", "b"}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			limit := flags.Int("limit", 0, "")
+			verbose := flags.Bool("v", false, "")
+			got, err := parseQueryFlags(flags, tt.args)
+			if err != nil {
+				t.Fatalf("parseQueryFlags(%q) error: %v", tt.args, err)
+			}
+			if !slices.Equal(got, tt.wantArgs) {
+				t.Errorf("parseQueryFlags(%q) = %q, want %q", tt.args, got, tt.wantArgs)
+			}
+			if *limit != tt.wantLimit || *verbose != tt.wantVerbose {
+				t.Errorf("parseQueryFlags(%q) set limit=%d v=%v, want limit=%d v=%v", tt.args, *limit, *verbose, tt.wantLimit, tt.wantVerbose)
+			}
+		})
+	}
+	for _, args := range [][]string{
+		{"rust", "--limit"},
+		{"rust", "--limit", "five"},
+		{"rust", "--limit=five"},
+		{"rust", "-v=maybe"},
+	} {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.Int("limit", 0, "")
+		flags.Bool("v", false, "")
+		if got, err := parseQueryFlags(flags, args); err == nil {
+			t.Errorf("parseQueryFlags(%q) = %q, want error", args, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            json.RawMessage      `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Author        *JSONFeedAuthor      `json:"author"`
+	Authors       []JSONFeedAuthor     `json:"authors"`
+	Tags          []string             `json:"tags"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type JSONFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	Title             string  `json:"title"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+func isJSONFeed(data []byte, contentType string) bool {
+	if strings.Contains(strings.ToLower(contentType), "json") {
+		return true
+	}
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// jsonFeedID accepts both string and numeric item IDs; the spec requires
+// strings but numbers are common in the wild.
+func jsonFeedID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func (j *JSONFeed) toRSS() *RSSFeed {
+	feed := &RSSFeed{}
+	feed.Channel.Title = j.Title
+	feed.Channel.Link = j.HomePageURL
+	feed.Channel.Description = j.Description
+	for _, item := range j.Items {
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+		description := item.Summary
+		if description == "" {
+			description = item.ContentHTML
+		}
+		if description == "" {
+			description = item.ContentText
+		}
+		pubDate := item.DatePublished
+		if pubDate == "" {
+			pubDate = item.DateModified
+		}
+		authors := item.Authors
+		if len(authors) == 0 && item.Author != nil {
+			authors = []JSONFeedAuthor{*item.Author}
+		}
+		var names []string
+		for _, author := range authors {
+			if author.Name != "" {
+				names = append(names, author.Name)
+			}
+		}
+		var enclosures []RSSEnclosure
+		for _, attachment := range item.Attachments {
+			enclosure := RSSEnclosure{URL: attachment.URL, Type: attachment.MimeType, Duration: int32(attachment.DurationInSeconds)}
+			if attachment.SizeInBytes > 0 {
+				enclosure.Length = strconv.FormatInt(attachment.SizeInBytes, 10)
+			}
+			enclosures = append(enclosures, enclosure)
+		}
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			GUID:        jsonFeedID(item.ID),
+			Title:       item.Title,
+			Link:        link,
+			Description: description,
+			Content:     item.ContentHTML,
+			PubDate:     pubDate,
+			Author:      strings.Join(names, ", "),
+			Categories:  item.Tags,
+			Enclosures:  enclosures,
+		})
+	}
+	return feed
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONFeedID(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`"abc-123"`, "abc-123"},
+		{`"  spaced  "`, "  spaced  "},
+		{`42`, "42"},
+		{`1234567890123456789`, "1234567890123456789"},
+		{`3.5`, "3.5"},
+		{``, ""},
+	}
+	for _, tt := range tests {
+		if got := jsonFeedID(json.RawMessage(tt.raw)); got != tt.want {
+			t.Errorf("jsonFeedID(%s) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
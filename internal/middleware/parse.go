@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+func parseFeed(data []byte, contentType string) (*RSSFeed, error) {
+	data, transcoded, err := transcodeToUTF8(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if isJSONFeed(data, contentType) {
+		jsonFeed := &JSONFeed{}
+		if err := json.Unmarshal(data, jsonFeed); err != nil {
+			return nil, err
+		}
+		return normalizeFeed(jsonFeed.toRSS()), nil
+	}
+	root, err := rootElement(newXMLDecoder(data, transcoded))
+	if err != nil {
+		return nil, err
+	}
+	var feed *RSSFeed
+	switch root.Local {
+	case "rss":
+		feed = &RSSFeed{}
+		if err := newXMLDecoder(data, transcoded).Decode(feed); err != nil {
+			return nil, err
+		}
+	case "feed":
+		atom := &AtomFeed{}
+		if err := newXMLDecoder(data, transcoded).Decode(atom); err != nil {
+			return nil, err
+		}
+		feed = atom.toRSS()
+	case "RDF":
+		rdf := &RDFFeed{}
+		if err := newXMLDecoder(data, transcoded).Decode(rdf); err != nil {
+			return nil, err
+		}
+		feed = rdf.toRSS()
+	default:
+		return nil, fmt.Errorf("unsupported feed format: <%s>", sanitizeForLog(root.Local))
+	}
+	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
+	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
+	return normalizeFeed(feed), nil
+}
+
+// normalizeFeed folds Dublin Core metadata into the standard item fields so
+// that scrapeFeeds only has to look at one place.
+func normalizeFeed(feed *RSSFeed) *RSSFeed {
+	for i := range feed.Channel.Item {
+		item := &feed.Channel.Item[i]
+		if strings.TrimSpace(item.PubDate) == "" {
+			item.PubDate = strings.TrimSpace(item.DCDate)
+		}
+		if strings.TrimSpace(item.Author) == "" {
+			item.Author = strings.TrimSpace(item.DCCreator)
+		}
+		item.Categories = cleanCategories(append(item.Categories, item.DCSubjects...))
+		item.Enclosures = collectEnclosures(*item)
+	}
+	return feed
+}
+
+// cleanCategories trims category names and drops blanks and repeats. The
+// result is never nil, so storing it clears categories an item no longer has.
+func cleanCategories(names []string) []string {
+	seen := make(map[string]bool)
+	cleaned := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		cleaned = append(cleaned, name)
+	}
+	return cleaned
+}
+
+// itemGUID returns the key that identifies item within its feed: the
+// publisher's guid if there is one, then the link, then a hash of the
+// content for items that carry neither.
+func itemGUID(item RSSItem) string {
+	if guid := strings.TrimSpace(item.GUID); guid != "" {
+		return guid
+	}
+	if link := strings.TrimSpace(item.Link); link != "" {
+		return link
+	}
+	return "sha256:" + itemContentHash(item)
+}
+
+// itemContentHash fingerprints the parts of an item a publisher is likely to
+// edit, so a refetch can tell whether the stored post is stale.
+func itemContentHash(item RSSItem) string {
+	sum := sha256.Sum256([]byte(item.Title + "\x00" + item.Description + "\x00" + item.PubDate))
+	return hex.EncodeToString(sum[:])
+}
+
+func rootElement(decoder *xml.Decoder) (xml.Name, error) {
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return xml.Name{}, fmt.Errorf("empty feed document")
+		}
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// transcodeToUTF8 converts data to UTF-8 when the HTTP Content-Type names a
+// charset. The HTTP charset takes precedence over the XML declaration, so
+// transcoded reports whether the declaration must now be ignored. A charset
+// that is missing or unknown, such as a typo, leaves the declaration (and
+// then UTF-8) in charge.
+func transcodeToUTF8(data []byte, contentType string) (out []byte, transcoded bool, err error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["charset"] == "" {
+		return data, false, nil
+	}
+	enc, name := charset.Lookup(params["charset"])
+	if enc == nil {
+		return data, false, nil
+	}
+	if name == "utf-8" {
+		return data, true, nil
+	}
+	out, err = enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("decoding %s: %v", name, err)
+	}
+	return out, true, nil
+}
+
+// newXMLDecoder returns a decoder that honours the encoding in the XML
+// declaration, or ignores it when the body has already been transcoded.
+func newXMLDecoder(data []byte, transcoded bool) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	if transcoded {
+		decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	} else {
+		decoder.CharsetReader = charset.NewReaderLabel
+	}
+	return decoder
+}
@@ -0,0 +1,337 @@
+package middleware
+
+import (
+	"reflect"
+	"testing"
+)
+
+// rssWithTitle builds a one-item RSS document around raw title bytes, so
+// tests can feed in text that is not valid UTF-8.
+func rssWithTitle(declaration, title string) []byte {
+	return []byte(declaration + `<rss version="2.0"><channel><title>` + title +
+		`</title><item><title>` + title + `</title><link>https://example.com/1</link></item></channel></rss>`)
+}
+
+func TestParseFeedCharsets(t *testing.T) {
+	const (
+		latin1Cafe    = "Caf\xe9"                  // "Café" in ISO-8859-1
+		shiftJISNihon = "\x93\xfa\x96\x7b\x8c\xea" // "日本語" in Shift_JIS
+	)
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		want        string
+	}{
+		{"ISO-8859-1 header", rssWithTitle("", latin1Cafe), "application/rss+xml; charset=ISO-8859-1", "Café"},
+		{"ISO-8859-1 declaration", rssWithTitle(`<?xml version="1.0" encoding="ISO-8859-1"?>`, latin1Cafe), "application/rss+xml", "Café"},
+		{"latin1 alias", rssWithTitle("", latin1Cafe), "text/xml; charset=latin1", "Café"},
+		{"Shift_JIS header", rssWithTitle("", shiftJISNihon), "application/rss+xml; charset=Shift_JIS", "日本語"},
+		{"Shift_JIS declaration", rssWithTitle(`<?xml version="1.0" encoding="Shift_JIS"?>`, shiftJISNihon), "text/xml", "日本語"},
+		// The HTTP charset wins over a declaration that disagrees with it.
+		{"header overrides declaration", rssWithTitle(`<?xml version="1.0" encoding="UTF-8"?>`, shiftJISNihon), "text/xml; charset=shift_jis", "日本語"},
+		{"UTF-8 with BOM", append([]byte("\xef\xbb\xbf"), rssWithTitle(`<?xml version="1.0" encoding="UTF-8"?>`, "日本語")...), "text/xml; charset=utf-8", "日本語"},
+		{"UTF-8 default", rssWithTitle("", "Café"), "", "Café"},
+		// An unknown HTTP charset is ignored rather than failing the feed.
+		{"unknown header, declaration", rssWithTitle(`<?xml version="1.0" encoding="ISO-8859-1"?>`, latin1Cafe), "text/xml; charset=none", "Café"},
+		{"unknown header, UTF-8", rssWithTitle("", "Café"), "text/xml; charset=utf8x", "Café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, err := parseFeed(tt.data, tt.contentType)
+			if err != nil {
+				t.Fatalf("parseFeed error: %v", err)
+			}
+			if feed.Channel.Title != tt.want {
+				t.Errorf("channel title = %q, want %q", feed.Channel.Title, tt.want)
+			}
+			if len(feed.Channel.Item) != 1 || feed.Channel.Item[0].Title != tt.want {
+				t.Errorf("items = %+v, want one titled %q", feed.Channel.Item, tt.want)
+			}
+		})
+	}
+}
+
+// feedChannel and feedItem are the parts of a parsed feed the rest of gator
+// reads. Empty slices are left nil so expectations can omit them.
+type feedChannel struct {
+	Title, Link, Description string
+}
+
+type feedItem struct {
+	GUID        string
+	Title       string
+	Link        string
+	Description string
+	Content     string
+	PubDate     string
+	Author      string
+	Comments    string
+	Source      RSSSource
+	Categories  []string
+	Enclosures  []RSSEnclosure
+}
+
+func parsedItems(feed *RSSFeed) []feedItem {
+	var items []feedItem
+	for _, item := range feed.Channel.Item {
+		parsed := feedItem{
+			GUID:        itemGUID(item),
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			Content:     item.Content,
+			PubDate:     item.PubDate,
+			Author:      item.Author,
+			Comments:    item.Comments,
+			Source:      item.Source,
+		}
+		if len(item.Categories) > 0 {
+			parsed.Categories = item.Categories
+		}
+		if len(item.Enclosures) > 0 {
+			parsed.Enclosures = item.Enclosures
+		}
+		items = append(items, parsed)
+	}
+	return items
+}
+
+func TestParseFeed(t *testing.T) {
+	atomChannel := feedChannel{"Example Blog", "https://example.com/", "News & notes"}
+	atomItems := []feedItem{
+		{
+			GUID:        "tag:example.com,2025:post-1",
+			Title:       "First &lt;post&gt;",
+			Link:        "https://example.com/posts/1",
+			Description: "Short summary",
+			Content:     "<p>Full text</p>",
+			PubDate:     "2025-09-02T04:30:00Z",
+			Author:      "Ada, Grace",
+			Categories:  []string{"Go", "feeds"},
+			Enclosures:  []RSSEnclosure{{URL: "https://example.com/1.mp3", Length: "1234", Type: "audio/mpeg", Medium: "audio"}},
+		},
+		{
+			// Only a rel="self" link, and xhtml content as the description.
+			GUID:        "tag:example.com,2025:post-2",
+			Title:       "Second",
+			Link:        "https://example.com/posts/2.atom",
+			Description: `<div xmlns="http://www.w3.org/1999/xhtml"><p>Inline</p></div>`,
+			Content:     `<div xmlns="http://www.w3.org/1999/xhtml"><p>Inline</p></div>`,
+			PubDate:     "2025-09-04T08:00:00+02:00",
+		},
+	}
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		channel     feedChannel
+		items       []feedItem
+	}{
+		{"Atom", atomFixture, "application/atom+xml", atomChannel, atomItems},
+		// Servers often label feeds as plain XML; the root element decides.
+		{"Atom as text/xml", atomFixture, "text/xml", atomChannel, atomItems},
+		// A leading "{" is enough to spot JSON Feed, and numeric ids are
+		// accepted although the spec asks for strings.
+		{"JSON Feed", jsonFeedFixture, "text/plain", feedChannel{"Example Feed", "https://example.org/", "A JSON feed"}, []feedItem{
+			{
+				GUID:        "https://example.org/1",
+				Title:       "First",
+				Link:        "https://example.org/posts/1",
+				Description: "Short summary",
+				Content:     "<p>Hello</p>",
+				PubDate:     "2025-09-02T04:30:00Z",
+				Author:      "Ada, Grace",
+				Categories:  []string{"go", "feeds"},
+				Enclosures:  []RSSEnclosure{{URL: "https://example.org/1.mp3", Length: "1234", Type: "audio/mpeg", Medium: "audio", Duration: 61}},
+			},
+			{
+				GUID:        "42",
+				Link:        "https://elsewhere.example/story",
+				Description: "Just a summary",
+				PubDate:     "2025-09-03T10:00:00+02:00",
+				Author:      "Legacy Author",
+			},
+			{GUID: "3", Description: "Plain text body"},
+		}},
+		// rdf:about is the guid, then the link; Dublin Core fills the date,
+		// author and categories.
+		{"RSS 1.0", rdfFixture, "application/rdf+xml", feedChannel{"Example RDF", "https://example.net/", "An RSS 1.0 feed"}, []feedItem{
+			{
+				GUID:        "https://example.net/items/1",
+				Title:       "First",
+				Link:        "https://example.net/items/1?utm_source=rss",
+				Description: "Body one",
+				PubDate:     "2025-09-02T04:30:00Z",
+				Author:      "Ada",
+				Categories:  []string{"go", "feeds"},
+			},
+			{GUID: "https://example.net/items/2", Title: "Second", Link: "https://example.net/items/2"},
+		}},
+		// Extension elements reusing a core name, such as itunes:author and
+		// atom:link, never replace or stand in for the core field.
+		{"RSS 2.0 with namespaced core names", mixedNamespaceFixture, "application/rss+xml", feedChannel{"Mixed", "https://example.com/", ""}, []feedItem{
+			{
+				GUID:        "post-1",
+				Title:       "Real title",
+				Link:        "https://example.com/posts/1",
+				Description: "Summary",
+				Content:     "<p>Body</p>",
+				PubDate:     "Tue, 02 Sep 2025 04:30:00 GMT",
+				Author:      "ada@example.com (Ada)",
+				Comments:    "https://example.com/posts/1#comments",
+				Source:      RSSSource{URL: "https://upstream.example/rss", Title: "Upstream"},
+				Categories:  []string{"go", "feeds"},
+			},
+			{GUID: "post-2", Title: "Only namespaced author", Author: "Grace"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, err := parseFeed([]byte(tt.data), tt.contentType)
+			if err != nil {
+				t.Fatalf("parseFeed error: %v", err)
+			}
+			channel := feedChannel{feed.Channel.Title, feed.Channel.Link, feed.Channel.Description}
+			if channel != tt.channel {
+				t.Errorf("channel = %+v, want %+v", channel, tt.channel)
+			}
+			items := parsedItems(feed)
+			if len(items) != len(tt.items) {
+				t.Fatalf("got %d items, want %d", len(items), len(tt.items))
+			}
+			for i := range items {
+				if !reflect.DeepEqual(items[i], tt.items[i]) {
+					t.Errorf("item %d = %+v\nwant %+v", i, items[i], tt.items[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseFeedRejectsUnknownRoot(t *testing.T) {
+	if _, err := parseFeed([]byte(`<html><body>Not a feed</body></html>`), "text/xml"); err == nil {
+		t.Error("parseFeed accepted an HTML document")
+	}
+}
+
+const atomFixture = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example Blog</title>
+  <subtitle type="html">News &amp;amp; notes</subtitle>
+  <link rel="self" href="https://example.com/atom.xml"/>
+  <link href="https://example.com/"/>
+  <entry>
+    <id>tag:example.com,2025:post-1</id>
+    <title type="html">First &amp;lt;post&amp;gt;</title>
+    <link rel="alternate" type="text/html" href="https://example.com/posts/1"/>
+    <link rel="enclosure" type="audio/mpeg" length="1234" href="https://example.com/1.mp3"/>
+    <summary>Short summary</summary>
+    <content type="html">&lt;p&gt;Full text&lt;/p&gt;</content>
+    <published>2025-09-02T04:30:00Z</published>
+    <updated>2025-09-03T04:30:00Z</updated>
+    <author><name>Ada</name></author>
+    <author><name>Grace</name></author>
+    <category term="go" label="Go"/>
+    <category term="feeds"/>
+  </entry>
+  <entry>
+    <id>tag:example.com,2025:post-2</id>
+    <title>Second</title>
+    <link rel="self" href="https://example.com/posts/2.atom"/>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Inline</p></div></content>
+    <updated>2025-09-04T08:00:00+02:00</updated>
+  </entry>
+</feed>`
+
+const jsonFeedFixture = `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Example Feed",
+  "home_page_url": "https://example.org/",
+  "description": "A JSON feed",
+  "items": [
+    {
+      "id": "https://example.org/1",
+      "url": "https://example.org/posts/1",
+      "title": "First",
+      "content_html": "<p>Hello</p>",
+      "content_text": "Hello",
+      "summary": "Short summary",
+      "date_published": "2025-09-02T04:30:00Z",
+      "authors": [{"name": "Ada"}, {"name": ""}, {"name": "Grace"}],
+      "tags": ["go", " go ", "feeds"],
+      "attachments": [{"url": "https://example.org/1.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 1234, "duration_in_seconds": 61.5}]
+    },
+    {
+      "id": 42,
+      "external_url": "https://elsewhere.example/story",
+      "summary": "Just a summary",
+      "date_modified": "2025-09-03T10:00:00+02:00",
+      "author": {"name": "Legacy Author"}
+    },
+    {
+      "id": "3",
+      "content_text": "Plain text body"
+    }
+  ]
+}`
+
+const rdfFixture = `<?xml version="1.0" encoding="utf-8"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+         xmlns="http://purl.org/rss/1.0/"
+         xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel rdf:about="https://example.net/">
+    <title>Example RDF</title>
+    <link>https://example.net/</link>
+    <description>An RSS 1.0 feed</description>
+  </channel>
+  <item rdf:about="https://example.net/items/1">
+    <title>First</title>
+    <link>https://example.net/items/1?utm_source=rss</link>
+    <description>Body one</description>
+    <dc:date>2025-09-02T04:30:00Z</dc:date>
+    <dc:creator>Ada</dc:creator>
+    <dc:subject>go</dc:subject>
+    <dc:subject>feeds</dc:subject>
+  </item>
+  <item>
+    <title>Second</title>
+    <link>https://example.net/items/2</link>
+  </item>
+</rdf:RDF>`
+
+const mixedNamespaceFixture = `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0"
+     xmlns:atom="http://www.w3.org/2005/Atom"
+     xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"
+     xmlns:content="http://purl.org/rss/1.0/modules/content/"
+     xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel>
+    <title>Mixed</title>
+    <link>https://example.com/</link>
+    <item>
+      <itunes:author>Podcast Network</itunes:author>
+      <author>ada@example.com (Ada)</author>
+      <link>https://example.com/posts/1</link>
+      <atom:link rel="self" href="https://example.com/posts/1.xml"/>
+      <guid isPermaLink="false">post-1</guid>
+      <atom:title>Atom title</atom:title>
+      <title>Real title</title>
+      <description>Summary</description>
+      <atom:category term="atom-only"/>
+      <category>go</category>
+      <content:encoded><![CDATA[<p>Body</p>]]></content:encoded>
+      <comments>https://example.com/posts/1#comments</comments>
+      <source url="https://upstream.example/rss">Upstream</source>
+      <dc:subject>feeds</dc:subject>
+      <pubDate>Tue, 02 Sep 2025 04:30:00 GMT</pubDate>
+    </item>
+    <item>
+      <title>Only namespaced author</title>
+      <guid>post-2</guid>
+      <itunes:author>Network</itunes:author>
+      <dc:creator>Grace</dc:creator>
+      <atom:link href="https://example.com/posts/2"/>
+    </item>
+  </channel>
+</rss>`
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// RDFFeed is an RSS 1.0 document, where items are siblings of the channel
+// rather than children of it.
+type RDFFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+	} `xml:"channel"`
+	Items []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	RSSItem
+	About string
+}
+
+// UnmarshalXML reads rdf:about itself, since the method RDFItem gets from
+// RSSItem would otherwise decode the element without it.
+func (item *RDFItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == rdfNamespace && attr.Name.Local == "about" {
+			item.About = attr.Value
+		}
+	}
+	return item.RSSItem.UnmarshalXML(d, start)
+}
+
+func (r *RDFFeed) toRSS() *RSSFeed {
+	feed := &RSSFeed{}
+	feed.Channel.Title = r.Channel.Title
+	feed.Channel.Link = r.Channel.Link
+	feed.Channel.Description = r.Channel.Description
+	for _, item := range r.Items {
+		if item.GUID == "" {
+			item.GUID = strings.TrimSpace(item.About)
+		}
+		feed.Channel.Item = append(feed.Channel.Item, item.RSSItem)
+	}
+	return feed
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	sqlc "github.com/diamondoughnut/gator/internal/database"
+)
+
+// permanentRedirectTarget walks the redirect chain that produced res and
+// returns the final URL if every hop was a 301 or 308. Temporary redirects
+// anywhere in the chain mean the original URL is still the one to keep.
+func permanentRedirectTarget(res *http.Response) string {
+	req := res.Request
+	if req == nil || req.Response == nil {
+		return ""
+	}
+	final := req.URL.String()
+	for req.Response != nil {
+		code := req.Response.StatusCode
+		if code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			return ""
+		}
+		req = req.Response.Request
+	}
+	if req.URL.String() == final {
+		return ""
+	}
+	return final
+}
+
+// moveFeed points a feed at newURL in one transaction. If another feed
+// already has that URL, the old feed's follows and posts are merged into it
+// and the old feed is deleted. It returns the feed that now owns the URL.
+func moveFeed(s *State, feed sqlc.Feed, newURL string) (sqlc.Feed, error) {
+	tx, err := s.Conn.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return sqlc.Feed{}, err
+	}
+	defer tx.Rollback()
+	q := s.Db.WithTx(tx)
+
+	existing, err := q.GetFeedByUrl(s.Ctx, newURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = q.UpdateFeedUrl(s.Ctx, sqlc.UpdateFeedUrlParams{ID: feed.ID, Url: newURL})
+		if err != nil {
+			return sqlc.Feed{}, fmt.Errorf("updating url: %w", err)
+		}
+		feed.Url = newURL
+		return feed, tx.Commit()
+	}
+	if err != nil {
+		return sqlc.Feed{}, fmt.Errorf("looking up %s: %w", newURL, err)
+	}
+	err = q.MoveFeedFollows(s.Ctx, sqlc.MoveFeedFollowsParams{NewFeedID: existing.ID, OldFeedID: feed.ID})
+	if err != nil {
+		return sqlc.Feed{}, fmt.Errorf("moving follows: %w", err)
+	}
+	err = q.MovePostStars(s.Ctx, sqlc.MovePostStarsParams{NewFeedID: existing.ID, OldFeedID: feed.ID})
+	if err != nil {
+		return sqlc.Feed{}, fmt.Errorf("moving stars: %w", err)
+	}
+	err = q.MovePostReads(s.Ctx, sqlc.MovePostReadsParams{NewFeedID: existing.ID, OldFeedID: feed.ID})
+	if err != nil {
+		return sqlc.Feed{}, fmt.Errorf("moving read state: %w", err)
+	}
+	err = q.MovePosts(s.Ctx, sqlc.MovePostsParams{NewFeedID: existing.ID, OldFeedID: feed.ID})
+	if err != nil {
+		return sqlc.Feed{}, fmt.Errorf("moving posts: %w", err)
+	}
+	err = q.DeleteFeed(s.Ctx, feed.ID)
+	if err != nil {
+		return sqlc.Feed{}, fmt.Errorf("deleting old feed: %w", err)
+	}
+	return existing, tx.Commit()
+}
+
+func isGone(err error) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusGone
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// rssCoreElements are the item elements whose names extensions reuse, such
+// as <itunes:title>, <itunes:author> and <atom:link>. encoding/xml matches
+// an untagged namespace against every namespace, so without filtering the
+// last of them would overwrite the real field.
+var rssCoreElements = map[string]bool{
+	"guid":        true,
+	"title":       true,
+	"link":        true,
+	"description": true,
+	"pubDate":     true,
+	"author":      true,
+	"category":    true,
+	"comments":    true,
+	"source":      true,
+	"enclosure":   true,
+}
+
+// UnmarshalXML decodes an item, dropping extension elements that share a
+// name with a core element. Core elements are those in the item's own
+// namespace: none for RSS 2.0 and the RSS 1.0 namespace for RDF.
+func (item *RSSItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	tokens := tokenList{start.Copy()}
+	for depth := 0; ; {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 0 && rssCoreElements[t.Name.Local] && t.Name.Space != start.Name.Space {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+		if depth < 0 {
+			break
+		}
+	}
+	// plain has RSSItem's fields and tags but not this method.
+	type plain RSSItem
+	return xml.NewTokenDecoder(&tokens).Decode((*plain)(item))
+}
+
+// tokenList replays tokens already read from another decoder.
+type tokenList []xml.Token
+
+func (l *tokenList) Token() (xml.Token, error) {
+	if len(*l) == 0 {
+		return nil, io.EOF
+	}
+	token := (*l)[0]
+	*l = (*l)[1:]
+	return token, nil
+}
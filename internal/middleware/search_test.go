@@ -0,0 +1,26 @@
+package middleware
+
+import "testing"
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"rust", "-async"}, "rust -async"},
+		{[]string{"rust -async"}, "rust -async"},
+		{[]string{"error handling", "golang"}, `"error handling" golang`},
+		{[]string{"  error   handling "}, `"error handling"`},
+		{[]string{`"error handling" -java`}, `"error handling" -java`},
+		{[]string{"postgres or mysql"}, "postgres or mysql"},
+		{[]string{"postgres", "OR", "mysql"}, "postgres OR mysql"},
+		{[]string{"kubernetes"}, "kubernetes"},
+		{[]string{" "}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := searchQuery(tt.args); got != tt.want {
+			t.Errorf("searchQuery(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
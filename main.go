@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/diamondoughnut/gator/internal/config"
 	sqlc "github.com/diamondoughnut/gator/internal/database"
@@ -21,8 +25,17 @@ func main() {
 		fmt.Printf("Error reading config: %v\n", err)
 		os.Exit(1)
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	currentState := middleware.State{}
 	currentState.CurrentCfg = &currentConfig
+	currentState.Ctx = ctx
+	fetcher, err := middleware.NewFetcher(&currentConfig)
+	if err != nil {
+		fmt.Printf("Error reading config: %v\n", err)
+		os.Exit(1)
+	}
+	currentState.Fetcher = fetcher
 	db, err := sql.Open("postgres", currentConfig.DbUrl)
 	if err != nil {
 		fmt.Printf("Error accessing database: %v\n", err)
@@ -31,6 +44,7 @@ func main() {
 	defer db.Close()
 	dbQueries := sqlc.New(db)
 	currentState.Db = dbQueries
+	currentState.Conn = db
 	commands := middleware.Commands{}
 	commands.Register("login", middleware.HandlerLogin)
 	commands.Register("register", middleware.HandlerRegister)
@@ -43,6 +57,13 @@ func main() {
 	commands.Register("following", middleware.MiddlewareLoggedIn(middleware.HandlerFollowing))
 	commands.Register("unfollow", middleware.MiddlewareLoggedIn(middleware.HandlerUnfollow))
 	commands.Register("browse", middleware.MiddlewareLoggedIn(middleware.HandlerBrowse))
+	commands.Register("history", middleware.MiddlewareLoggedIn(middleware.HandlerHistory))
+	commands.Register("read", middleware.MiddlewareLoggedIn(middleware.HandlerRead))
+	commands.Register("unread", middleware.MiddlewareLoggedIn(middleware.HandlerUnread))
+	commands.Register("star", middleware.MiddlewareLoggedIn(middleware.HandlerStar))
+	commands.Register("unstar", middleware.MiddlewareLoggedIn(middleware.HandlerUnstar))
+	commands.Register("starred", middleware.MiddlewareLoggedIn(middleware.HandlerStarred))
+	commands.Register("search", middleware.MiddlewareLoggedIn(middleware.HandlerSearch))
 	args := os.Args
 	if len(args) < 2 {
 		fmt.Println("No command provided")
@@ -53,7 +74,36 @@ func main() {
 	err = commands.Run(&currentState, middleware.Command{Name: commandArg, Args: commandArgs, Execute: nil})
 	if err != nil {
 		fmt.Printf("Error running command: %v\n", err)
-		os.Exit(1)
+		code, hint := classifyError(err)
+		if hint != "" {
+			fmt.Println(hint)
+		}
+		os.Exit(code)
+	}
+}
+
+// classifyError maps the middleware's sentinel errors to an exit code and a
+// hint for the user. Anything unrecognised (usually a database error) exits 1.
+func classifyError(err error) (int, string) {
+	switch {
+	case errors.Is(err, middleware.ErrInvalidArgument):
+		return 2, "Check the command's arguments and try again."
+	case errors.Is(err, middleware.ErrNotLoggedIn):
+		return 3, "Log in with `gator login <name>` or create a user with `gator register <name>`."
+	case errors.Is(err, middleware.ErrNotFound):
+		return 4, "Nothing matched; check the spelling or list what exists with `gator users` or `gator feeds`."
+	case errors.Is(err, middleware.ErrAlreadyExists):
+		return 5, ""
+	case errors.Is(err, middleware.ErrNetwork):
+		return 6, "The feed could not be reached; check the URL and your connection."
+	case errors.Is(err, middleware.ErrParse):
+		return 7, "The response could not be read as a feed."
+	case errors.Is(err, middleware.ErrFeedsFailed):
+		return 8, "See the report above for the failing feeds."
+	case errors.Is(err, middleware.ErrInterrupted):
+		return 9, "The run was stopped before every due feed was fetched; run it again."
+	default:
+		return 1, ""
 	}
 }
 
@@ -1,6 +1,6 @@
 -- name: CreateFeedFollow :one
 WITH inserted_feed_follow AS (
-    INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_url)
+    INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
     VALUES ($1, $2, $3, $4, $5)
     RETURNING *
 )
@@ -9,19 +9,30 @@ SELECT
     feeds.name AS feed_name,
     users.name AS user_name
 FROM inserted_feed_follow
-INNER JOIN feeds ON inserted_feed_follow.feed_url = feeds.url
+INNER JOIN feeds ON inserted_feed_follow.feed_id = feeds.id
 INNER JOIN users ON inserted_feed_follow.user_id = users.id;
 
 -- name: GetFeedFollowsForUser :many
 SELECT
     feed_follows.*,
     feeds.name AS feed_name,
+    feeds.url AS feed_url,
     users.name AS user_name
 FROM feed_follows
-INNER JOIN feeds ON feed_follows.feed_url = feeds.url
+INNER JOIN feeds ON feed_follows.feed_id = feeds.id
 INNER JOIN users ON feed_follows.user_id = users.id
 WHERE users.id = $1;
 
--- name: DeleteFeedFollowByUserAndFeedUrl :exec
+-- name: DeleteFeedFollowByUserAndFeed :execrows
 DELETE FROM feed_follows
-WHERE user_id = $1 AND feed_url = $2;
\ No newline at end of file
+WHERE user_id = $1 AND feed_id = $2;
+
+-- Follows that would duplicate an existing follow of the target feed are
+-- left behind and removed when the old feed is deleted.
+-- name: MoveFeedFollows :exec
+UPDATE feed_follows
+SET feed_id = sqlc.arg(new_feed_id), updated_at = NOW()
+WHERE feed_follows.feed_id = sqlc.arg(old_feed_id)
+AND feed_follows.user_id NOT IN (
+    SELECT user_id FROM feed_follows AS existing WHERE existing.feed_id = sqlc.arg(new_feed_id)
+);
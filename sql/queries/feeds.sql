@@ -9,12 +9,71 @@ SELECT * FROM feeds;
 -- name: GetFeedByUrl :one
 SELECT * FROM feeds WHERE url = $1;
 
+-- name: GetFeedByID :one
+SELECT * FROM feeds WHERE id = $1;
+
+-- name: GetFeedsByName :many
+SELECT * FROM feeds WHERE name = $1;
+
 -- name: MarkFeedFetched :exec
+-- release_claim is false when the feed was merged into during the fetch of
+-- another one: its claim, if any, belongs to whoever holds it.
+UPDATE feeds
+SET last_fetched_at = NOW(), updated_at = NOW(),
+    claimed_until = CASE WHEN sqlc.arg(release_claim)::boolean THEN NULL ELSE claimed_until END,
+    consecutive_failures = 0, next_fetch_at = NULL
+WHERE id = sqlc.arg(id);
+
+-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_until = NULL
+WHERE id = $1;
+
+-- Backoff doubles from 2 minutes with each consecutive failure, capped at a day.
+-- name: RecordFeedFailure :exec
+-- release_claim works as in MarkFeedFetched.
+UPDATE feeds
+SET last_fetched_at = NOW(), updated_at = NOW(),
+    claimed_until = CASE WHEN sqlc.arg(release_claim)::boolean THEN NULL ELSE claimed_until END,
+    consecutive_failures = consecutive_failures + 1,
+    last_error = sqlc.arg(last_error),
+    last_error_at = NOW(),
+    next_fetch_at = NOW() + LEAST(
+        INTERVAL '2 minutes' * POWER(2, LEAST(consecutive_failures, 10)),
+        INTERVAL '1 day'
+    )
+WHERE id = sqlc.arg(id);
+
+-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET claimed_until = NOW() + (sqlc.arg(lease_seconds)::int * INTERVAL '1 second')
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE (claimed_until IS NULL OR claimed_until < NOW())
+    AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+    AND dead_at IS NULL
+    AND (last_fetched_at IS NULL OR last_fetched_at < NOW() - (sqlc.arg(min_age_seconds)::int * INTERVAL '1 second'))
+    ORDER BY last_fetched_at NULLS FIRST
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: UpdateFeedCacheHeaders :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkFeedDead :exec
+UPDATE feeds
+SET dead_at = NOW(), updated_at = NOW(), last_fetched_at = NOW(), claimed_until = NULL,
+    last_error = $2, last_error_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateFeedUrl :exec
 UPDATE feeds
-SET last_fetched_at = NOW(), updated_at = NOW()
-WHERE url = $1;
+SET url = $2, updated_at = NOW()
+WHERE id = $1;
 
--- name: GetNextFeedToFetch :one
-SELECT * FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
-LIMIT 1;
\ No newline at end of file
+-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- name: SetPostCategories :exec
+-- Replaces a post's categories with names.
+WITH removed AS (
+    DELETE FROM post_categories
+    WHERE post_categories.post_id = sqlc.arg(post_id) AND post_categories.name <> ALL(sqlc.arg(names)::text[])
+)
+INSERT INTO post_categories (post_id, name)
+SELECT DISTINCT sqlc.arg(post_id)::uuid, unnest(sqlc.arg(names)::text[])
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,26 @@
+-- name: SetPostEnclosures :exec
+-- Replaces a post's enclosures. The arrays are parallel, one entry per
+-- enclosure, and must not repeat a url.
+WITH removed AS (
+    DELETE FROM post_enclosures
+    WHERE post_enclosures.post_id = sqlc.arg(post_id) AND post_enclosures.url <> ALL(sqlc.arg(urls)::text[])
+)
+INSERT INTO post_enclosures (post_id, url, mime_type, medium, length, duration_seconds, position)
+SELECT sqlc.arg(post_id)::uuid, e.url,
+    (sqlc.arg(mime_types)::text[])[e.position],
+    (sqlc.arg(media)::text[])[e.position],
+    (sqlc.arg(lengths)::bigint[])[e.position],
+    (sqlc.arg(durations)::integer[])[e.position],
+    e.position
+FROM unnest(sqlc.arg(urls)::text[]) WITH ORDINALITY AS e(url, position)
+ON CONFLICT (post_id, md5(url)) DO UPDATE
+SET mime_type = EXCLUDED.mime_type,
+    medium = EXCLUDED.medium,
+    length = EXCLUDED.length,
+    duration_seconds = EXCLUDED.duration_seconds,
+    position = EXCLUDED.position;
+
+-- name: GetEnclosuresForPosts :many
+SELECT * FROM post_enclosures
+WHERE post_id = ANY(sqlc.arg(post_ids)::uuid[])
+ORDER BY post_id, position;
@@ -0,0 +1,37 @@
+-- name: MarkPostsRead :execrows
+-- Marks the user's posts matching every non-NULL filter as read. Only posts
+-- in feeds the user follows are affected; older_than compares against the
+-- publish date, or the fetch time for posts without one.
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, sqlc.arg(read_at)::timestamp
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(post_id)::uuid IS NULL OR posts.id = sqlc.narg(post_id)::uuid)
+AND (sqlc.narg(url)::text IS NULL OR posts.url = sqlc.narg(url)::text)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND (sqlc.narg(older_than)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < sqlc.narg(older_than)::timestamp)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostsUnread :execrows
+-- The inverse of MarkPostsRead, taking the same filters.
+DELETE FROM post_reads
+USING posts
+WHERE post_reads.post_id = posts.id
+AND post_reads.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(post_id)::uuid IS NULL OR posts.id = sqlc.narg(post_id)::uuid)
+AND (sqlc.narg(url)::text IS NULL OR posts.url = sqlc.narg(url)::text)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND (sqlc.narg(older_than)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < sqlc.narg(older_than)::timestamp);
+
+-- name: MovePostReads :exec
+-- Before a feed is merged into another, read marks on posts the other feed
+-- already has are moved to its copy so they survive the old feed's deletion.
+UPDATE post_reads
+SET post_id = existing.id
+FROM posts AS old, posts AS existing
+WHERE post_reads.post_id = old.id
+AND old.feed_id = sqlc.arg(old_feed_id)
+AND existing.feed_id = sqlc.arg(new_feed_id)
+AND existing.guid = old.guid
+AND NOT EXISTS (SELECT 1 FROM post_reads AS kept WHERE kept.user_id = post_reads.user_id AND kept.post_id = existing.id);
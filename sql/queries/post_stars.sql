@@ -0,0 +1,50 @@
+-- name: StarPosts :execrows
+-- Stars the posts in the user's followed feeds matching post_id or url.
+-- Starring a post again replaces its note and tags when they are given.
+INSERT INTO post_stars (user_id, post_id, created_at, updated_at, note, tags)
+SELECT feed_follows.user_id, posts.id, sqlc.arg(starred_at)::timestamp, sqlc.arg(starred_at)::timestamp,
+    COALESCE(sqlc.narg(note)::text, ''), COALESCE(sqlc.narg(tags)::text[], '{}')
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(post_id)::uuid IS NULL OR posts.id = sqlc.narg(post_id)::uuid)
+AND (sqlc.narg(url)::text IS NULL OR posts.url = sqlc.narg(url)::text)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET note = COALESCE(sqlc.narg(note)::text, post_stars.note),
+    tags = COALESCE(sqlc.narg(tags)::text[], post_stars.tags),
+    updated_at = EXCLUDED.updated_at;
+
+-- name: UnstarPosts :execrows
+DELETE FROM post_stars
+USING posts
+WHERE post_stars.post_id = posts.id
+AND post_stars.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(post_id)::uuid IS NULL OR posts.id = sqlc.narg(post_id)::uuid)
+AND (sqlc.narg(url)::text IS NULL OR posts.url = sqlc.narg(url)::text);
+
+-- name: GetStarredPostsForUser :many
+-- Starred posts stay listed even after the user unfollows their feed.
+SELECT posts.id, posts.title, posts.url, feeds.name AS feed_name,
+    post_stars.note, post_stars.tags, post_stars.created_at AS starred_at
+FROM post_stars
+INNER JOIN posts ON post_stars.post_id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE post_stars.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(tag)::text IS NULL OR post_stars.tags @> ARRAY[sqlc.narg(tag)::text])
+ORDER BY post_stars.created_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: MovePostStars :exec
+-- Before a feed is merged into another, stars on posts the other feed
+-- already has are moved to its copy so they survive the old feed's deletion.
+UPDATE post_stars
+SET post_id = existing.id, updated_at = NOW()
+FROM posts AS old, posts AS existing
+WHERE post_stars.post_id = old.id
+AND old.feed_id = sqlc.arg(old_feed_id)
+AND existing.feed_id = sqlc.arg(new_feed_id)
+AND existing.guid = old.guid
+AND NOT EXISTS (
+    SELECT 1 FROM post_stars AS kept
+    WHERE kept.user_id = post_stars.user_id AND kept.post_id = existing.id
+);
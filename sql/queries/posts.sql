@@ -1,11 +1,178 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, description, published_at, url, feed_url)
-VALUES (DEFAULT, $1, $2, $3, $4, $5, $6, $7)
-RETURNING *;
+-- name: UpsertPost :one
+-- Inserts a new item, or rewrites a stored one whose content hash,
+-- metadata or attachments changed; only a changed content hash counts as a
+-- revision.
+-- Items without a usable date are dated fetched_at when first stored and
+-- keep their stored date on later updates.
+-- A post stored before guids were tracked is adopted instead: when no post
+-- has the item's guid yet, a legacy post with the same link takes it over.
+-- The version being replaced is copied to post_revisions first; every
+-- sub-statement sees the table as it was before the upsert. No row comes
+-- back when the stored post was already up to date.
+WITH previous AS (
+    SELECT posts.id, posts.title, posts.description, posts.published_at, posts.content_hash
+    FROM posts
+    WHERE posts.feed_id = sqlc.arg(feed_id) AND md5(posts.guid) = md5(sqlc.arg(guid)::text)
+), legacy AS (
+    SELECT posts.id
+    FROM posts
+    WHERE posts.feed_id = sqlc.arg(feed_id) AND posts.legacy_guid
+    AND md5(posts.url) = md5(sqlc.arg(url)::text)
+    AND NOT EXISTS (SELECT 1 FROM previous)
+    LIMIT 1
+), adopted AS (
+    UPDATE posts
+    SET guid = sqlc.arg(guid)::text,
+        legacy_guid = FALSE,
+        title = sqlc.arg(title)::text,
+        description = sqlc.arg(description)::text,
+        published_at = COALESCE(sqlc.narg(published_at)::timestamp, posts.published_at),
+        url = sqlc.arg(url)::text,
+        content_hash = sqlc.narg(content_hash)::text,
+        author = sqlc.arg(author)::text,
+        content = sqlc.arg(content)::text,
+        comments_url = sqlc.arg(comments_url)::text,
+        source_title = sqlc.arg(source_title)::text,
+        source_url = sqlc.arg(source_url)::text,
+        attachments_hash = sqlc.narg(attachments_hash)::text,
+        updated_at = sqlc.arg(updated_at)::timestamp
+    FROM legacy
+    WHERE posts.id = legacy.id
+    RETURNING posts.id
+), upserted AS (
+    INSERT INTO posts (id, created_at, updated_at, title, description, published_at, url, feed_id, guid, content_hash, author, content, comments_url, source_title, source_url, attachments_hash)
+    SELECT sqlc.arg(id)::uuid, sqlc.arg(created_at)::timestamp, sqlc.arg(updated_at)::timestamp, sqlc.arg(title)::text, sqlc.arg(description)::text, COALESCE(sqlc.narg(published_at)::timestamp, sqlc.arg(fetched_at)::timestamp), sqlc.arg(url)::text, sqlc.arg(feed_id)::uuid, sqlc.arg(guid)::text, sqlc.narg(content_hash)::text, sqlc.arg(author)::text, sqlc.arg(content)::text, sqlc.arg(comments_url)::text, sqlc.arg(source_title)::text, sqlc.arg(source_url)::text, sqlc.narg(attachments_hash)::text
+    WHERE NOT EXISTS (SELECT 1 FROM legacy)
+    ON CONFLICT (feed_id, md5(guid)) DO UPDATE
+    SET title = EXCLUDED.title,
+        description = EXCLUDED.description,
+        published_at = COALESCE(sqlc.narg(published_at)::timestamp, posts.published_at),
+        url = EXCLUDED.url,
+        content_hash = EXCLUDED.content_hash,
+        author = EXCLUDED.author,
+        content = EXCLUDED.content,
+        comments_url = EXCLUDED.comments_url,
+        source_title = EXCLUDED.source_title,
+        source_url = EXCLUDED.source_url,
+        attachments_hash = EXCLUDED.attachments_hash,
+        updated_at = EXCLUDED.updated_at
+    WHERE posts.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+       OR posts.url IS DISTINCT FROM EXCLUDED.url
+       OR posts.attachments_hash IS DISTINCT FROM EXCLUDED.attachments_hash
+       OR (posts.author, posts.content, posts.comments_url, posts.source_title, posts.source_url)
+          IS DISTINCT FROM (EXCLUDED.author, EXCLUDED.content, EXCLUDED.comments_url, EXCLUDED.source_title, EXCLUDED.source_url)
+    RETURNING posts.id, posts.content_hash
+), revision AS (
+    INSERT INTO post_revisions (post_id, created_at, title, description, published_at, content_hash)
+    SELECT previous.id, sqlc.arg(updated_at)::timestamp, previous.title, previous.description, previous.published_at, previous.content_hash
+    FROM previous
+    INNER JOIN upserted ON upserted.id = previous.id
+    WHERE previous.content_hash IS NOT NULL
+      AND previous.content_hash IS DISTINCT FROM upserted.content_hash
+)
+SELECT upserted.id FROM upserted
+UNION ALL
+SELECT adopted.id FROM adopted;
 
 -- name: GetPostsForUser :many
-SELECT posts.* FROM posts
-INNER JOIN feed_follows ON posts.feed_url = feed_follows.feed_url
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC NULLS LAST
-LIMIT $2;
\ No newline at end of file
+-- author matches any part of the author, category a whole category name;
+-- both ignore case. media keeps posts with an enclosure of one of the given
+-- media, feed_id posts from one feed, and since/until bound the publish
+-- date (the fetch time for posts without one). Each filter is skipped when
+-- NULL. Read posts are left out unless include_read is set.
+--
+-- sort_by is published (newest first), fetched (most recently stored
+-- first) or feed (by feed name, then newest first). Pages are fetched
+-- either by offset or by passing the sort position of the last row seen
+-- (after_*), which stays stable while new posts arrive.
+SELECT posts.id, posts.title, posts.url, posts.description, posts.content,
+    posts.published_at, posts.feed_id, posts.author, posts.comments_url,
+    posts.source_title, posts.source_url,
+    feeds.name AS feed_name, feeds.url AS feed_url,
+    COALESCE((
+        SELECT array_agg(post_categories.name ORDER BY post_categories.name)
+        FROM post_categories WHERE post_categories.post_id = posts.id
+    ), '{}')::text[] AS categories,
+    (post_reads.post_id IS NOT NULL)::boolean AS read,
+    (CASE WHEN sqlc.arg(sort_by)::text = 'fetched' THEN posts.created_at
+          ELSE COALESCE(posts.published_at, posts.created_at) END)::timestamp AS sort_time
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_reads ON post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.arg(include_read)::boolean OR post_reads.post_id IS NULL)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND (sqlc.narg(since)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= sqlc.narg(since)::timestamp)
+AND (sqlc.narg(until)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < sqlc.narg(until)::timestamp)
+AND (sqlc.narg(author)::text IS NULL OR strpos(lower(posts.author), lower(sqlc.narg(author)::text)) > 0)
+AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_categories
+    WHERE post_categories.post_id = posts.id AND lower(post_categories.name) = lower(sqlc.narg(category)::text)
+))
+AND (sqlc.narg(media)::text[] IS NULL OR EXISTS (
+    SELECT 1 FROM post_enclosures
+    WHERE post_enclosures.post_id = posts.id AND post_enclosures.medium = ANY(sqlc.narg(media)::text[])
+))
+AND (sqlc.narg(after_id)::uuid IS NULL OR (
+    CASE WHEN sqlc.arg(sort_by)::text = 'feed' THEN
+        (feeds.name, feeds.id) > (sqlc.narg(after_feed_name)::text, sqlc.narg(after_feed_id)::uuid)
+        OR ((feeds.name, feeds.id) = (sqlc.narg(after_feed_name)::text, sqlc.narg(after_feed_id)::uuid)
+            AND (COALESCE(posts.published_at, posts.created_at), posts.id) < (sqlc.narg(after_time)::timestamp, sqlc.narg(after_id)::uuid))
+    WHEN sqlc.arg(sort_by)::text = 'fetched' THEN
+        (posts.created_at, posts.id) < (sqlc.narg(after_time)::timestamp, sqlc.narg(after_id)::uuid)
+    ELSE
+        (COALESCE(posts.published_at, posts.created_at), posts.id) < (sqlc.narg(after_time)::timestamp, sqlc.narg(after_id)::uuid)
+    END
+))
+ORDER BY
+    CASE WHEN sqlc.arg(sort_by)::text = 'feed' THEN feeds.name END,
+    CASE WHEN sqlc.arg(sort_by)::text = 'feed' THEN feeds.id END,
+    sort_time DESC,
+    posts.id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = sqlc.arg(new_feed_id), updated_at = NOW()
+WHERE posts.feed_id = sqlc.arg(old_feed_id)
+AND NOT EXISTS (
+    SELECT 1 FROM posts AS existing
+    WHERE existing.feed_id = sqlc.arg(new_feed_id) AND existing.guid = posts.guid
+);
+
+-- name: GetPostRevisionsForUser :many
+-- Earlier versions of the post with post_id, or of every post at url, in
+-- feeds the user follows. Revisions of one post are adjacent, newest first.
+SELECT post_revisions.*, posts.title AS current_title, feeds.name AS feed_name
+FROM post_revisions
+INNER JOIN posts ON post_revisions.post_id = posts.id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(post_id)::uuid IS NULL OR posts.id = sqlc.narg(post_id)::uuid)
+AND (sqlc.narg(url)::text IS NULL OR posts.url = sqlc.narg(url)::text)
+ORDER BY feeds.name, posts.id, post_revisions.created_at DESC;
+
+-- name: SearchPostsForUser :many
+-- query uses web search syntax: "quoted phrases", -excluded words and OR.
+-- Only posts in feeds the user follows are searched, best matches first.
+-- The snippet is taken from the content, or the description when there is
+-- none, with HTML tags removed and matches wrapped in ** **.
+SELECT posts.id, posts.title, posts.url, posts.published_at,
+    feeds.name AS feed_name,
+    ts_rank(posts.search_vector, query)::real AS rank,
+    ts_headline('english',
+        regexp_replace(CASE WHEN posts.content <> '' THEN posts.content ELSE posts.description END, '<[^>]*>', ' ', 'g'),
+        query,
+        'StartSel="**", StopSel="**", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" ... "'
+    )::text AS snippet
+FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+CROSS JOIN websearch_to_tsquery('english', sqlc.arg(query)::text) AS query
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND posts.search_vector @@ query
+ORDER BY rank DESC, posts.published_at DESC NULLS LAST, posts.id
+LIMIT sqlc.arg('limit');
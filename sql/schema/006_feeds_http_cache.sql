@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN IF NOT EXISTS etag TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS last_modified TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN IF EXISTS etag,
+DROP COLUMN IF EXISTS last_modified;
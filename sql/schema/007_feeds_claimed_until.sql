@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN IF EXISTS claimed_until;
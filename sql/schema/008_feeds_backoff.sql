@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN IF NOT EXISTS consecutive_failures INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS last_error TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS last_error_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS next_fetch_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN IF EXISTS consecutive_failures,
+DROP COLUMN IF EXISTS last_error,
+DROP COLUMN IF EXISTS last_error_at,
+DROP COLUMN IF EXISTS next_fetch_at;
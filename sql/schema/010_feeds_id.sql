@@ -0,0 +1,45 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS id UUID NOT NULL DEFAULT uuid_generate_v4();
+
+ALTER TABLE feed_follows ADD COLUMN IF NOT EXISTS feed_id UUID;
+UPDATE feed_follows SET feed_id = feeds.id FROM feeds WHERE feed_follows.feed_url = feeds.url;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS feed_id UUID;
+UPDATE posts SET feed_id = feeds.id FROM feeds WHERE posts.feed_url = feeds.url;
+
+-- Dropping the url columns also drops their foreign keys and the
+-- (user_id, feed_url) unique constraint.
+ALTER TABLE feed_follows DROP COLUMN feed_url;
+ALTER TABLE posts DROP COLUMN feed_url;
+
+ALTER TABLE feeds DROP CONSTRAINT feeds_pkey;
+ALTER TABLE feeds ADD PRIMARY KEY (id);
+ALTER TABLE feeds ADD CONSTRAINT feeds_url_key UNIQUE (url);
+
+ALTER TABLE feed_follows ALTER COLUMN feed_id SET NOT NULL;
+ALTER TABLE feed_follows ADD CONSTRAINT feed_follows_feed_id_fkey FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE;
+ALTER TABLE feed_follows ADD CONSTRAINT feed_follows_user_id_feed_id_key UNIQUE (user_id, feed_id);
+ALTER TABLE posts ALTER COLUMN feed_id SET NOT NULL;
+ALTER TABLE posts ADD CONSTRAINT posts_feed_id_fkey FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS feeds_name_idx ON feeds (name);
+
+-- +goose Down
+DROP INDEX IF EXISTS feeds_name_idx;
+ALTER TABLE feed_follows ADD COLUMN feed_url VARCHAR(255);
+UPDATE feed_follows SET feed_url = feeds.url FROM feeds WHERE feed_follows.feed_id = feeds.id;
+ALTER TABLE posts ADD COLUMN feed_url VARCHAR(255);
+UPDATE posts SET feed_url = feeds.url FROM feeds WHERE posts.feed_id = feeds.id;
+
+ALTER TABLE feed_follows DROP COLUMN feed_id;
+ALTER TABLE posts DROP COLUMN feed_id;
+
+ALTER TABLE feeds DROP CONSTRAINT feeds_url_key;
+ALTER TABLE feeds DROP CONSTRAINT feeds_pkey;
+ALTER TABLE feeds ADD PRIMARY KEY (url);
+ALTER TABLE feeds DROP COLUMN id;
+
+ALTER TABLE feed_follows ALTER COLUMN feed_url SET NOT NULL;
+ALTER TABLE feed_follows ADD CONSTRAINT feed_follows_feed_url_fkey FOREIGN KEY (feed_url) REFERENCES feeds(url) ON DELETE CASCADE;
+ALTER TABLE feed_follows ADD CONSTRAINT feed_follows_user_id_feed_url_key UNIQUE (user_id, feed_url);
+ALTER TABLE posts ALTER COLUMN feed_url SET NOT NULL;
+ALTER TABLE posts ADD CONSTRAINT posts_feed_url_fkey FOREIGN KEY (feed_url) REFERENCES feeds(url) ON DELETE CASCADE;
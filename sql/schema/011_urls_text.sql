@@ -0,0 +1,23 @@
+-- +goose Up
+-- B-tree index entries are limited to roughly 2.7kB, so long URLs are made
+-- unique through an index on their MD5 instead of on the text itself.
+ALTER TABLE feeds DROP CONSTRAINT IF EXISTS feeds_url_key;
+ALTER TABLE feeds ALTER COLUMN url TYPE TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS feeds_url_md5_key ON feeds (md5(url));
+CREATE INDEX IF NOT EXISTS feeds_url_idx ON feeds USING HASH (url);
+
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_url_key;
+ALTER TABLE posts ALTER COLUMN url TYPE TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS posts_url_md5_key ON posts (md5(url));
+CREATE INDEX IF NOT EXISTS posts_url_idx ON posts USING HASH (url);
+
+-- +goose Down
+DROP INDEX IF EXISTS posts_url_idx;
+DROP INDEX IF EXISTS posts_url_md5_key;
+ALTER TABLE posts ALTER COLUMN url TYPE VARCHAR(255);
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
+
+DROP INDEX IF EXISTS feeds_url_idx;
+DROP INDEX IF EXISTS feeds_url_md5_key;
+ALTER TABLE feeds ALTER COLUMN url TYPE VARCHAR(255);
+ALTER TABLE feeds ADD CONSTRAINT feeds_url_key UNIQUE (url);
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Posts are identified within their feed by guid: the item's <guid>/<id>
+-- when it has one, otherwise its link, otherwise a hash of its content.
+-- Existing rows only ever had their link to go on, so they are flagged as
+-- legacy and UpsertPost hands them the real guid the first time it is seen.
+ALTER TABLE posts ADD COLUMN guid TEXT;
+ALTER TABLE posts ADD COLUMN legacy_guid BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE posts SET guid = url, legacy_guid = TRUE;
+ALTER TABLE posts ALTER COLUMN guid SET NOT NULL;
+
+DROP INDEX IF EXISTS posts_url_md5_key;
+CREATE UNIQUE INDEX IF NOT EXISTS posts_feed_guid_key ON posts (feed_id, md5(guid));
+CREATE INDEX IF NOT EXISTS posts_legacy_guid_idx ON posts (feed_id, md5(url)) WHERE legacy_guid;
+
+-- +goose Down
+DROP INDEX IF EXISTS posts_legacy_guid_idx;
+DROP INDEX IF EXISTS posts_feed_guid_key;
+DELETE FROM posts a USING posts b
+WHERE md5(a.url) = md5(b.url) AND (a.created_at, a.id) > (b.created_at, b.id);
+CREATE UNIQUE INDEX IF NOT EXISTS posts_url_md5_key ON posts (md5(url));
+ALTER TABLE posts DROP COLUMN legacy_guid;
+ALTER TABLE posts DROP COLUMN guid;
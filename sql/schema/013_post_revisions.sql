@@ -0,0 +1,19 @@
+-- +goose Up
+-- content_hash is NULL for posts stored before it existed; the first fetch
+-- that sees them fills it in without recording a revision.
+ALTER TABLE posts ADD COLUMN content_hash TEXT;
+
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    title TEXT NOT NULL,
+    description TEXT NOT NULL,
+    published_at TIMESTAMP,
+    content_hash TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS post_revisions_post_id_idx ON post_revisions (post_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS post_revisions;
+ALTER TABLE posts DROP COLUMN content_hash;
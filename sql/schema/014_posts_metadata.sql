@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN author TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN content TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN comments_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN source_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN source_url TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS posts_author_idx ON posts (lower(author));
+
+CREATE TABLE IF NOT EXISTS post_categories (
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    PRIMARY KEY (post_id, name)
+);
+CREATE INDEX IF NOT EXISTS post_categories_name_idx ON post_categories (lower(name));
+
+-- +goose Down
+DROP TABLE IF EXISTS post_categories;
+DROP INDEX IF EXISTS posts_author_idx;
+ALTER TABLE posts DROP COLUMN source_url;
+ALTER TABLE posts DROP COLUMN source_title;
+ALTER TABLE posts DROP COLUMN comments_url;
+ALTER TABLE posts DROP COLUMN content;
+ALTER TABLE posts DROP COLUMN author;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Audio, video and image attachments gathered from <enclosure>, Media RSS,
+-- the iTunes namespace, Atom enclosure links and JSON Feed attachments.
+-- medium is audio, video, image or empty when it cannot be told; length and
+-- duration_seconds are 0 when the feed does not say.
+CREATE TABLE IF NOT EXISTS post_enclosures (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    mime_type TEXT NOT NULL DEFAULT '',
+    medium TEXT NOT NULL DEFAULT '',
+    length BIGINT NOT NULL DEFAULT 0,
+    duration_seconds INTEGER NOT NULL DEFAULT 0,
+    position INTEGER NOT NULL DEFAULT 0
+);
+CREATE UNIQUE INDEX IF NOT EXISTS post_enclosures_post_url_key ON post_enclosures (post_id, md5(url));
+CREATE INDEX IF NOT EXISTS post_enclosures_medium_idx ON post_enclosures (medium, post_id);
+
+-- Fingerprint of a post's categories and enclosures, so changes to either
+-- (and posts stored before enclosures were kept) are written on refetch.
+ALTER TABLE posts ADD COLUMN attachments_hash TEXT;
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN attachments_hash;
+DROP TABLE IF EXISTS post_enclosures;
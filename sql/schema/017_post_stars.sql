@@ -0,0 +1,17 @@
+-- +goose Up
+-- Posts a user has saved for later. There is no retention pruning of posts
+-- today; anything added that deletes old posts must skip those referenced
+-- here so saved links are never lost.
+CREATE TABLE IF NOT EXISTS post_stars (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    note TEXT NOT NULL DEFAULT '',
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (user_id, post_id)
+);
+CREATE INDEX IF NOT EXISTS post_stars_tags_idx ON post_stars USING GIN (tags);
+
+-- +goose Down
+DROP TABLE IF EXISTS post_stars;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Titles rank above descriptions, which rank above the full content.
+ALTER TABLE posts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', description), 'B') ||
+    setweight(to_tsvector('english', content), 'C')
+) STORED;
+CREATE INDEX IF NOT EXISTS posts_search_vector_idx ON posts USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX IF EXISTS posts_search_vector_idx;
+ALTER TABLE posts DROP COLUMN search_vector;